@@ -0,0 +1,312 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ProdriveTechnologies/snippets/pkg/dates"
+	"github.com/ProdriveTechnologies/snippets/pkg/schema"
+	"github.com/gorilla/mux"
+	"github.com/jinzhu/gorm"
+)
+
+// registerApiRoutes adds a versioned JSON API to the router. It
+// provides access to the same users, posts and subscriptions that are
+// exposed through the HTML pages, so that they can be scripted against.
+func (sws *SnippetsWebService) registerApiRoutes(router *mux.Router) {
+	api := router.PathPrefix("/api/v1").Subrouter()
+	api.HandleFunc("/search", sws.handleApiSearch).Methods("GET")
+	api.HandleFunc("/users", sws.handleApiUserList).Methods("GET")
+	api.HandleFunc("/users/{user_name:[a-z]+}", sws.handleApiUser).Methods("GET")
+	api.HandleFunc("/users/{user_name:[a-z]+}/snippets", sws.handleApiSnippetList).Methods("GET")
+	api.HandleFunc("/users/{user_name:[a-z]+}/snippets/{year:[0-9]{4}}-W{week:[0-9]{2}}", sws.handleApiSnippet).Methods("GET", "PUT", "DELETE")
+	api.HandleFunc("/users/{user_name:[a-z]+}/subscriptions", sws.handleApiSubscriptionList).Methods("GET")
+	api.HandleFunc("/users/{user_name:[a-z]+}/subscriptions/{subscribee:[a-z]+}", sws.handleApiSubscription).Methods("GET", "PUT", "DELETE")
+	api.HandleFunc("/users/{user_name:[a-z]+}/subscribers", sws.handleApiSubscriberList).Methods("GET")
+	api.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		handleApiError(w, "Resource not found", http.StatusNotFound)
+	})
+}
+
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// handleApiError is the JSON counterpart of handleErrorPage.
+func handleApiError(w http.ResponseWriter, message string, code int) {
+	log.Print(message)
+	writeApiResponse(w, apiError{Error: message}, code)
+}
+
+func writeApiResponse(w http.ResponseWriter, value interface{}, code int) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		log.Print(err)
+	}
+}
+
+// normalizeLines converts text provided through the API to the format
+// in which snippet bodies are stored: non-empty lines without any
+// unnecessary whitespace.
+func normalizeLines(input string) string {
+	var lines []string
+	for _, line := range strings.Split(input, "\n") {
+		line = strings.Join(strings.Fields(line), " ")
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (sws *SnippetsWebService) handleApiUserList(w http.ResponseWriter, req *http.Request) {
+	users := []schema.User{}
+	if r := sws.database.Order("user_name").Find(&users); r.Error != nil {
+		handleApiError(w, r.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeApiResponse(w, users, http.StatusOK)
+}
+
+func (sws *SnippetsWebService) handleApiUser(w http.ResponseWriter, req *http.Request) {
+	var user schema.User
+	if r := sws.database.Where("user_name = ?", mux.Vars(req)["user_name"]).Take(&user); r.Error != nil {
+		if gorm.IsRecordNotFoundError(r.Error) {
+			handleApiError(w, "User not found", http.StatusNotFound)
+		} else {
+			handleApiError(w, r.Error.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	writeApiResponse(w, user, http.StatusOK)
+}
+
+func (sws *SnippetsWebService) handleApiSnippetList(w http.ResponseWriter, req *http.Request) {
+	db, err := sws.whereVisible(sws.database, getCurrentUser(req))
+	if err != nil {
+		handleApiError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	posts := []schema.Post{}
+	if r := db.Where("user_name = ?", mux.Vars(req)["user_name"]).Order("year DESC, week DESC").Find(&posts); r.Error != nil {
+		handleApiError(w, r.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+	if posts, err = sws.withoutPrivateLines(posts, getCurrentUser(req)); err != nil {
+		handleApiError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	versions, err := getPostVersions(sws.database, mux.Vars(req)["user_name"])
+	if err != nil {
+		handleApiError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for i := range posts {
+		posts[i].Version = versions[dates.IsoWeek{Year: posts[i].Year, Week: posts[i].Week}]
+	}
+	writeApiResponse(w, posts, http.StatusOK)
+}
+
+func (sws *SnippetsWebService) handleApiSnippet(w http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	week := dates.ParseIsoWeek(vars["year"], vars["week"])
+	if week == nil {
+		handleApiError(w, "Invalid week", http.StatusNotFound)
+		return
+	}
+
+	userName := vars["user_name"]
+	if req.Method != "GET" && userName != getCurrentUser(req) {
+		handleApiError(w, "Snippets from other users cannot be edited", http.StatusForbidden)
+		return
+	}
+
+	var post schema.Post
+	found := true
+	if r := sws.database.Where("user_name = ? AND year = ? AND week = ?", userName, week.Year, week.Week).Take(&post); r.Error != nil {
+		if !gorm.IsRecordNotFoundError(r.Error) {
+			handleApiError(w, r.Error.Error(), http.StatusInternalServerError)
+			return
+		}
+		found = false
+	}
+	if found && req.Method == "GET" {
+		if visible, err := sws.canRead(getCurrentUser(req), post); err != nil {
+			handleApiError(w, err.Error(), http.StatusInternalServerError)
+			return
+		} else if !visible {
+			found = false
+		} else if withoutPrivateLines, err := sws.withoutPrivateLines([]schema.Post{post}, getCurrentUser(req)); err != nil {
+			handleApiError(w, err.Error(), http.StatusInternalServerError)
+			return
+		} else {
+			post = withoutPrivateLines[0]
+		}
+	}
+
+	// Optimistic concurrency control is provided through the ETag and
+	// If-Match headers, containing the version of the snippet.
+	expectedVersion := anyPostVersion
+	if ifMatch := req.Header.Get("If-Match"); ifMatch != "" && ifMatch != "*" {
+		version, err := strconv.Atoi(strings.Trim(strings.TrimPrefix(ifMatch, "W/"), `"`))
+		if err != nil {
+			handleApiError(w, "Malformed If-Match header", http.StatusBadRequest)
+			return
+		}
+		expectedVersion = version
+	}
+
+	switch req.Method {
+	case "GET":
+		if !found {
+			handleApiError(w, "Snippet not found", http.StatusNotFound)
+			return
+		}
+		// The version is derived from the revisions of the snippet,
+		// as that is what If-Match is compared against when saving.
+		version, err := getPostVersion(sws.database, userName, *week)
+		if err != nil {
+			handleApiError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		post.Version = version
+		w.Header().Set("ETag", fmt.Sprintf("\"%d\"", version))
+		writeApiResponse(w, post, http.StatusOK)
+	case "PUT":
+		var body struct {
+			BodyThisWeek string `json:"body_this_week"`
+			BodyNextWeek string `json:"body_next_week"`
+			Visibility   string `json:"visibility"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			handleApiError(w, "Malformed request body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if body.Visibility != "" && !schema.IsValidVisibility(body.Visibility) {
+			handleApiError(w, "Invalid visibility", http.StatusBadRequest)
+			return
+		}
+		newPost := schema.Post{
+			UserName:     userName,
+			Year:         week.Year,
+			Week:         week.Week,
+			BodyThisWeek: normalizeLines(body.BodyThisWeek),
+			BodyNextWeek: normalizeLines(body.BodyNextWeek),
+			Format:       schema.PostFormatMarkdown,
+		}
+		version, err := sws.savePost(req, userName, *week, newPost.BodyThisWeek, newPost.BodyNextWeek, body.Visibility, expectedVersion)
+		if err == errPostConflict {
+			handleApiError(w, err.Error(), http.StatusPreconditionFailed)
+			return
+		} else if err != nil {
+			handleApiError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("ETag", fmt.Sprintf("\"%d\"", version))
+		if newPost.BodyThisWeek == "" && newPost.BodyNextWeek == "" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		// Reload the snippet to obtain its resulting visibility.
+		if r := sws.database.Where("user_name = ? AND year = ? AND week = ?", userName, week.Year, week.Week).Take(&newPost); r.Error != nil {
+			handleApiError(w, r.Error.Error(), http.StatusInternalServerError)
+			return
+		}
+		newPost.Version = version
+		if found {
+			writeApiResponse(w, newPost, http.StatusOK)
+		} else {
+			writeApiResponse(w, newPost, http.StatusCreated)
+		}
+	case "DELETE":
+		if !found {
+			handleApiError(w, "Snippet not found", http.StatusNotFound)
+			return
+		}
+		if _, err := sws.savePost(req, userName, *week, "", "", "", expectedVersion); err == errPostConflict {
+			handleApiError(w, err.Error(), http.StatusPreconditionFailed)
+			return
+		} else if err != nil {
+			handleApiError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (sws *SnippetsWebService) handleApiSubscriptionList(w http.ResponseWriter, req *http.Request) {
+	subscriptions := []schema.Subscription{}
+	if r := sws.database.Where("subscriber = ?", mux.Vars(req)["user_name"]).Order("subscribee").Find(&subscriptions); r.Error != nil {
+		handleApiError(w, r.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeApiResponse(w, subscriptions, http.StatusOK)
+}
+
+func (sws *SnippetsWebService) handleApiSubscriberList(w http.ResponseWriter, req *http.Request) {
+	subscriptions := []schema.Subscription{}
+	if r := sws.database.Where("subscribee = ?", mux.Vars(req)["user_name"]).Order("subscriber").Find(&subscriptions); r.Error != nil {
+		handleApiError(w, r.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeApiResponse(w, subscriptions, http.StatusOK)
+}
+
+func (sws *SnippetsWebService) handleApiSubscription(w http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	subscription := schema.Subscription{
+		Subscriber: vars["user_name"],
+		Subscribee: vars["subscribee"],
+	}
+	if req.Method != "GET" && subscription.Subscriber != getCurrentUser(req) {
+		handleApiError(w, "Subscriptions of other users cannot be modified", http.StatusForbidden)
+		return
+	}
+
+	switch req.Method {
+	case "GET":
+		if r := sws.database.Where(&subscription).Take(&subscription); r.Error != nil {
+			if gorm.IsRecordNotFoundError(r.Error) {
+				handleApiError(w, "Subscription not found", http.StatusNotFound)
+			} else {
+				handleApiError(w, r.Error.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+		writeApiResponse(w, subscription, http.StatusOK)
+	case "PUT":
+		if subscription.Subscriber == subscription.Subscribee {
+			handleApiError(w, "Users cannot subscribe to themselves", http.StatusBadRequest)
+			return
+		}
+		var subscribee schema.User
+		if r := sws.database.Where("user_name = ?", subscription.Subscribee).Take(&subscribee); r.Error != nil {
+			if gorm.IsRecordNotFoundError(r.Error) {
+				handleApiError(w, "User not found", http.StatusNotFound)
+			} else {
+				handleApiError(w, r.Error.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+		if err := sws.createOrUpdateUser(req); err != nil {
+			handleApiError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if r := sws.database.FirstOrCreate(&subscription); r.Error != nil {
+			handleApiError(w, r.Error.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeApiResponse(w, subscription, http.StatusOK)
+	case "DELETE":
+		if r := sws.database.Where(&subscription).Delete(&schema.Subscription{}); r.Error != nil {
+			handleApiError(w, r.Error.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
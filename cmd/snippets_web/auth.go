@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ProdriveTechnologies/snippets/pkg/schema"
+	"github.com/ProdriveTechnologies/snippets/pkg/tokens"
+	"github.com/jinzhu/gorm"
+)
+
+// identity of the user performing a request.
+type identity struct {
+	UserName string
+	// Whether the real name and email address of the user are known,
+	// meaning that they may be used to update the user's profile.
+	HasProfile   bool
+	RealName     string
+	EmailAddress string
+}
+
+type contextKey int
+
+const (
+	// Context key under which the identity of the user is stored.
+	identityKey contextKey = iota
+	// Context key under which the CSRF token of the session is stored.
+	csrfTokenKey
+)
+
+// getIdentity returns the identity of the user performing the request,
+// as determined by the authenticate middleware.
+func getIdentity(req *http.Request) identity {
+	id, _ := req.Context().Value(identityKey).(identity)
+	return id
+}
+
+// getCurrentUser returns the name of the user performing the request.
+func getCurrentUser(req *http.Request) string {
+	return getIdentity(req).UserName
+}
+
+func withIdentity(req *http.Request, id identity) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), identityKey, id))
+}
+
+// Prefix of API tokens, distinguishing them from bearer tokens that
+// the authenticating proxy may forward, such as the access tokens of
+// users.
+const apiTokenPrefix = "snippets_"
+
+// getApiToken returns the API token provided in the Authorization
+// header of a request, if any.
+func getApiToken(req *http.Request) (string, bool) {
+	authorization := req.Header.Get("Authorization")
+	if !strings.HasPrefix(authorization, "Bearer "+apiTokenPrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(authorization, "Bearer "), true
+}
+
+// isPublicPath returns whether a page may be accessed without logging
+// in. Feeds and unsubscribe links provide their own means of
+// authentication.
+func isPublicPath(path string) bool {
+	for _, prefix := range []string{"/auth/", "/feeds/", "/static/", "/unsubscribe/"} {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return path == "/health" || path == "/metrics"
+}
+
+// authenticate is middleware that determines the identity of the user
+// performing a request. Clients of the JSON API may authenticate by
+// providing an API token as a bearer token. Otherwise, the user is
+// either identified by their session cookie when OpenID Connect login
+// is enabled, or by the headers set by the authenticating proxy. The latter are rejected if
+// they cannot be proven to originate from a trusted proxy.
+func (sws *SnippetsWebService) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if token, ok := getApiToken(req); ok {
+			// API tokens only grant access to the JSON API, so that
+			// they cannot be used to create further tokens.
+			if !strings.HasPrefix(req.URL.Path, "/api/") {
+				handleApiError(w, "API tokens may only be used for the JSON API", http.StatusForbidden)
+				return
+			}
+			sws.authenticateApiToken(w, req, next, token)
+			return
+		}
+
+		if sws.login == nil {
+			if hasIdentityHeaders(req) && sws.proxyTrust != nil {
+				if err := sws.proxyTrust.Verify(req); err != nil {
+					log.Print("Rejecting identity headers: ", err)
+					http.Error(w, "Identity headers have not been set by a trusted proxy", http.StatusForbidden)
+					return
+				}
+			}
+			next.ServeHTTP(w, withIdentity(req, identity{
+				UserName:     req.Header.Get("X-Auth-Subject"),
+				HasProfile:   true,
+				RealName:     req.Header.Get("X-Auth-Name"),
+				EmailAddress: req.Header.Get("X-Auth-Email"),
+			}))
+			return
+		}
+
+		var id identity
+		if err := sws.sessions.Get(req, sessionCookieName, &id); err != nil || id.UserName == "" {
+			if isPublicPath(req.URL.Path) {
+				next.ServeHTTP(w, req)
+			} else if strings.HasPrefix(req.URL.Path, "/api/") {
+				handleApiError(w, "Not logged in", http.StatusUnauthorized)
+			} else if req.Method != "GET" {
+				sws.handleErrorPage(w, req, "Not logged in", http.StatusUnauthorized)
+			} else {
+				http.Redirect(w, req, sws.selfUrl+"auth/login?return_to="+url.QueryEscape(req.URL.RequestURI()), http.StatusSeeOther)
+			}
+			return
+		}
+		next.ServeHTTP(w, withIdentity(req, id))
+	})
+}
+
+func (sws *SnippetsWebService) authenticateApiToken(w http.ResponseWriter, req *http.Request, next http.Handler, token string) {
+	var apiToken schema.ApiToken
+	if r := sws.database.Where("token_hash = ?", tokens.Hash(token)).Take(&apiToken); r.Error != nil {
+		if gorm.IsRecordNotFoundError(r.Error) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			handleApiError(w, "Invalid API token", http.StatusUnauthorized)
+		} else {
+			handleApiError(w, r.Error.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	if r := sws.database.Model(&apiToken).Update("last_used_at", time.Now()); r.Error != nil {
+		log.Print("Failed to update last use of API token: ", r.Error)
+	}
+	// The user's real name and email address are not known when
+	// authenticating using an API token.
+	next.ServeHTTP(w, withIdentity(req, identity{UserName: apiToken.UserName}))
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	netMail "net/mail"
+	"strconv"
+	"strings"
+	textTemplate "text/template"
+	"time"
+
+	"github.com/ProdriveTechnologies/snippets/pkg/dates"
+	"github.com/ProdriveTechnologies/snippets/pkg/mail"
+	"github.com/ProdriveTechnologies/snippets/pkg/markdown"
+	"github.com/ProdriveTechnologies/snippets/pkg/schema"
+	"github.com/gorilla/mux"
+	"github.com/jinzhu/gorm"
+)
+
+// commentNode is a comment as displayed on a snippet page, together
+// with its replies.
+type commentNode struct {
+	schema.Comment
+	AuthorRealName string
+	RenderedBody   []template.HTML
+	CanReply       bool
+	Replies        []*commentNode
+}
+
+// PostWeek returns the week of the post on which the comment was left.
+func (cn *commentNode) PostWeek() dates.IsoWeek {
+	return dates.IsoWeek{Year: cn.Year, Week: cn.Week}
+}
+
+// getComments returns the threads of comments that were left on a post.
+func (sws *SnippetsWebService) getComments(userName string, week dates.IsoWeek, canReply bool) ([]*commentNode, error) {
+	var comments []schema.Comment
+	if r := sws.database.Where("user_name = ? AND year = ? AND week = ?", userName, week.Year, week.Week).Order("created_at, id").Find(&comments); r.Error != nil {
+		return nil, r.Error
+	}
+
+	// Obtain real names of the authors of the comments.
+	var authors []string
+	for _, comment := range comments {
+		authors = append(authors, comment.Author)
+	}
+	var users []schema.User
+	if r := sws.database.Where("user_name IN (?)", authors).Find(&users); r.Error != nil {
+		return nil, r.Error
+	}
+	realNames := map[string]string{}
+	for _, user := range users {
+		realNames[user.UserName] = user.RealName
+	}
+
+	// Attach replies to their parents. Replies always have a higher
+	// identifier than their parents, so a single pass suffices.
+	nodes := map[int64]*commentNode{}
+	var threads []*commentNode
+	for _, comment := range comments {
+		node := &commentNode{
+			Comment:        comment,
+			AuthorRealName: realNames[comment.Author],
+			RenderedBody:   markdown.RenderBody(comment.Body, true),
+			CanReply:       canReply,
+		}
+		nodes[comment.ID] = node
+		if comment.ParentID != nil {
+			if parent, ok := nodes[*comment.ParentID]; ok {
+				parent.Replies = append(parent.Replies, node)
+				continue
+			}
+		}
+		threads = append(threads, node)
+	}
+	return threads, nil
+}
+
+// canComment returns whether a user may leave comments on the posts of
+// another user. This is permitted for the author and for the users to
+// whom posts that are visible to subscribers are shown, being
+// subscribers, including those through teams, and team members.
+func (sws *SnippetsWebService) canComment(currentUser string, userName string) (bool, error) {
+	if currentUser == userName {
+		return true, nil
+	}
+	related, err := sws.getRelatedUsers(currentUser)
+	if err != nil {
+		return false, err
+	}
+	return related[userName], nil
+}
+
+func (sws *SnippetsWebService) handleCommentCreate(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		sws.handleErrorPage(w, req, "Expected POST request", http.StatusMethodNotAllowed)
+		return
+	}
+
+	vars := mux.Vars(req)
+	week := dates.ParseIsoWeek(vars["year"], vars["week"])
+	if week == nil {
+		http.NotFound(w, req)
+		return
+	}
+
+	userName := vars["user_name"]
+	currentUser := getCurrentUser(req)
+	if allowed, err := sws.canComment(currentUser, userName); err != nil {
+		sws.handleErrorPage(w, req, err.Error(), http.StatusInternalServerError)
+		return
+	} else if !allowed {
+		sws.handleErrorPage(w, req, "Only subscribers can comment on snippets", http.StatusForbidden)
+		return
+	}
+	var post schema.Post
+	if r := sws.database.Where("user_name = ? AND year = ? AND week = ?", userName, week.Year, week.Week).Take(&post); r.Error == nil {
+		if visible, err := sws.canRead(currentUser, post); err != nil {
+			sws.handleErrorPage(w, req, err.Error(), http.StatusInternalServerError)
+			return
+		} else if !visible {
+			sws.handleErrorPage(w, req, "Snippet is not visible to you", http.StatusForbidden)
+			return
+		}
+	} else if !gorm.IsRecordNotFoundError(r.Error) {
+		sws.handleErrorPage(w, req, r.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	req.ParseForm()
+	body := normalizeLines(req.Form.Get("body"))
+	if body == "" {
+		sws.handleErrorPage(w, req, "Comments cannot be empty", http.StatusBadRequest)
+		return
+	}
+	comment := schema.Comment{
+		UserName:  userName,
+		Year:      week.Year,
+		Week:      week.Week,
+		Author:    currentUser,
+		CreatedAt: time.Now(),
+		Body:      body,
+	}
+
+	// Replies must belong to the same post as their parent.
+	var parent schema.Comment
+	if parentId := req.Form.Get("parent_id"); parentId != "" {
+		id, err := strconv.ParseInt(parentId, 10, 64)
+		if err != nil {
+			sws.handleErrorPage(w, req, "Invalid parent comment", http.StatusBadRequest)
+			return
+		}
+		if r := sws.database.Where("id = ? AND user_name = ? AND year = ? AND week = ?", id, userName, week.Year, week.Week).Take(&parent); r.Error != nil {
+			if gorm.IsRecordNotFoundError(r.Error) {
+				sws.handleErrorPage(w, req, "Parent comment not found", http.StatusBadRequest)
+			} else {
+				sws.handleErrorPage(w, req, r.Error.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+		comment.ParentID = &parent.ID
+	}
+
+	if err := sws.createOrUpdateUser(req); err != nil {
+		sws.handleErrorPage(w, req, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if r := sws.database.Create(&comment); r.Error != nil {
+		sws.handleErrorPage(w, req, r.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Notify the author of the snippet and of the comment that is
+	// replied to, but never the author of the new comment.
+	recipients := []string{userName}
+	if comment.ParentID != nil && parent.Author != userName {
+		recipients = append(recipients, parent.Author)
+	}
+	for _, recipient := range recipients {
+		if recipient != currentUser {
+			sws.notifyComment(recipient, comment)
+		}
+	}
+
+	http.Redirect(w, req, fmt.Sprintf("%s%s/%s#comment-%d", sws.selfUrl, userName, week, comment.ID), http.StatusSeeOther)
+}
+
+// notifyComment sends an email to a user about a new comment. Failures
+// are only logged, as the comment itself has been stored successfully.
+func (sws *SnippetsWebService) notifyComment(recipient string, comment schema.Comment) {
+	if sws.mailSender == nil {
+		return
+	}
+
+	var users []schema.User
+	if r := sws.database.Where("user_name IN (?)", []string{recipient, comment.Author}).Find(&users); r.Error != nil {
+		log.Print("Failed to notify ", recipient, " of comment: ", r.Error)
+		return
+	}
+	usersMap := map[string]schema.User{}
+	for _, user := range users {
+		usersMap[user.UserName] = user
+	}
+	user := usersMap[recipient]
+	if user.EmailAddress == "" {
+		return
+	}
+
+	authorRealName := usersMap[comment.Author].RealName
+	week := dates.IsoWeek{Year: comment.Year, Week: comment.Week}
+	data := struct {
+		SnippetsUrl    string
+		RealName       string
+		AuthorRealName string
+		IsOwnSnippet   bool
+		Week           dates.IsoWeek
+		Comment        schema.Comment
+		Body           []template.HTML
+	}{
+		SnippetsUrl:    sws.selfUrl,
+		RealName:       user.RealName,
+		AuthorRealName: authorRealName,
+		IsOwnSnippet:   recipient == comment.UserName,
+		Week:           week,
+		Comment:        comment,
+		Body:           markdown.RenderBody(comment.Body, true),
+	}
+	html := bytes.NewBuffer([]byte{})
+	if err := commentEmailBody.Execute(html, data); err != nil {
+		log.Print("Failed to render comment notification: ", err)
+		return
+	}
+	text := strings.Builder{}
+	if err := commentEmailText.Execute(&text, data); err != nil {
+		log.Print("Failed to render comment notification: ", err)
+		return
+	}
+	message, err := mail.Message{
+		From:    sws.mailFrom,
+		To:      netMail.Address{Name: user.RealName, Address: user.EmailAddress},
+		Subject: fmt.Sprintf("New comment by %s on snippets for %s", authorRealName, week),
+		Text:    text.String(),
+		HTML:    html.String(),
+	}.Bytes()
+	if err != nil {
+		log.Print("Failed to render comment notification: ", err)
+		return
+	}
+	if err := sws.mailSender.Send(user.EmailAddress, message); err != nil {
+		log.Print("Failed to send email to ", user.EmailAddress, ": ", err)
+	}
+}
+
+var commentEmailBody = template.Must(template.New("email").Parse(
+	`<!DOCTYPE html>
+<html>
+	<head>
+		<title>Snippets</title>
+	</head>
+	<body>
+		<p>Hello {{.RealName}},</p>
+
+		<p>{{.AuthorRealName}} left a comment on
+		{{if .IsOwnSnippet}}your snippet{{else}}a snippet you commented on{{end}}
+		for {{.Week}}:</p>
+
+		<blockquote>
+			{{range .Body}}
+				<p>{{.}}</p>
+			{{end}}
+		</blockquote>
+
+		<p><a href="{{.SnippetsUrl}}{{.Comment.UserName}}/{{.Week}}#comment-{{.Comment.ID}}">View the conversation</a></p>
+	</body>
+</html>`))
+
+var commentEmailText = textTemplate.Must(textTemplate.New("text").Parse(
+	`Hello {{.RealName}},
+
+{{.AuthorRealName}} left a comment on {{if .IsOwnSnippet}}your snippet{{else}}a snippet you commented on{{end}} for {{.Week}}:
+
+{{.Comment.Body}}
+
+View the conversation: {{.SnippetsUrl}}{{.Comment.UserName}}/{{.Week}}#comment-{{.Comment.ID}}
+`))
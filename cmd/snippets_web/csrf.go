@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ProdriveTechnologies/snippets/pkg/tokens"
+)
+
+// Cookie containing the token that needs to be submitted along with
+// forms.
+const csrfCookieName = "snippets_csrf"
+
+// templateFuncs contains placeholders for the functions that templates
+// may call. They are replaced by newTemplateSet, as their results
+// depend on the request.
+var templateFuncs = template.FuncMap{
+	"csrfToken":   func() string { return "" },
+	"currentPath": func() string { return "/" },
+}
+
+// templateSet is a copy of the templates whose functions provide the
+// values of the request that is being rendered. As templates can only
+// be copied before they are executed, which is expensive, copies are
+// reused across requests.
+type templateSet struct {
+	templates *template.Template
+	req       *http.Request
+}
+
+func (sws *SnippetsWebService) newTemplateSet() (*templateSet, error) {
+	templates, err := sws.templates.Clone()
+	if err != nil {
+		return nil, err
+	}
+	set := &templateSet{templates: templates}
+	templates.Funcs(template.FuncMap{
+		"csrfToken": func() string {
+			token, _ := set.req.Context().Value(csrfTokenKey).(string)
+			return token
+		},
+		"currentPath": func() string { return set.req.URL.RequestURI() },
+	})
+	return set, nil
+}
+
+// executeTemplate renders a template, providing it with the functions
+// that depend on the request.
+func (sws *SnippetsWebService) executeTemplate(w http.ResponseWriter, req *http.Request, name string, data interface{}) error {
+	set, ok := sws.templateSets.Get().(*templateSet)
+	if !ok {
+		var err error
+		if set, err = sws.newTemplateSet(); err != nil {
+			return err
+		}
+	}
+	set.req = req
+	err := set.templates.ExecuteTemplate(w, name, data)
+	set.req = nil
+	sws.templateSets.Put(set)
+	return err
+}
+
+// isSafeMethod returns whether requests using a given method never
+// change any state.
+func isSafeMethod(method string) bool {
+	return method == "GET" || method == "HEAD" || method == "OPTIONS"
+}
+
+// protectFromCsrf is middleware that protects against cross-site
+// request forgery. Every browser session is given a random token that
+// is stored in a signed cookie. Forms that change state need to submit
+// it in a hidden csrf_token field.
+func (sws *SnippetsWebService) protectFromCsrf(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		// Requests authenticated using API tokens are not sent by
+		// browsers. Other methods than POST cannot be used by
+		// cross-site forms, meaning the JSON API needs no protection.
+		if _, ok := getApiToken(req); ok ||
+			(strings.HasPrefix(req.URL.Path, "/api/") && req.Method != "POST") ||
+			isPublicPath(req.URL.Path) {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		var token string
+		if err := sws.sessions.Get(req, csrfCookieName, &token); err != nil || token == "" {
+			if !isSafeMethod(req.Method) {
+				sws.handleErrorPage(w, req, "Your session has expired. Please go back, reload the page and try again.", http.StatusForbidden)
+				return
+			}
+			if token, _, err = tokens.Generate(); err != nil {
+				sws.handleErrorPage(w, req, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if err := sws.sessions.Set(w, csrfCookieName, token, 30*24*time.Hour); err != nil {
+				sws.handleErrorPage(w, req, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		if !isSafeMethod(req.Method) {
+			submitted := req.Header.Get("X-CSRF-Token")
+			if submitted == "" {
+				submitted = req.PostFormValue("csrf_token")
+			}
+			if subtle.ConstantTimeCompare([]byte(submitted), []byte(token)) != 1 {
+				sws.handleErrorPage(w, req, "Invalid CSRF token. Please go back, reload the page and try again.", http.StatusForbidden)
+				return
+			}
+		}
+		next.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), csrfTokenKey, token)))
+	})
+}
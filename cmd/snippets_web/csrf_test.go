@@ -0,0 +1,137 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ProdriveTechnologies/snippets/pkg/session"
+)
+
+// newCsrfTestService returns a service whose templates display the
+// values provided by the functions that depend on the request.
+func newCsrfTestService() *SnippetsWebService {
+	return &SnippetsWebService{
+		templates: template.Must(template.New("").Funcs(templateFuncs).Parse(
+			`{{define "error.html"}}{{.Message}}{{end}}{{define "form.html"}}{{csrfToken}} {{currentPath}}{{end}}`)),
+		sessions: &session.Store{Key: []byte("key")},
+	}
+}
+
+// csrfCookie returns a cookie containing a CSRF token.
+func csrfCookie(t *testing.T, sws *SnippetsWebService, token string) *http.Cookie {
+	recorder := httptest.NewRecorder()
+	if err := sws.sessions.Set(recorder, csrfCookieName, token, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	return recorder.Result().Cookies()[0]
+}
+
+func TestProtectFromCsrf(t *testing.T) {
+	sws := newCsrfTestService()
+	handler := sws.protectFromCsrf(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if err := sws.executeTemplate(w, req, "form.html", nil); err != nil {
+			t.Error(err)
+		}
+	}))
+
+	for _, test := range []struct {
+		name          string
+		method        string
+		path          string
+		cookieToken   string
+		formToken     string
+		headers       map[string]string
+		expectedCode  int
+		expectedToken string
+	}{
+		{name: "GetWithoutCookie", method: "GET", path: "/", expectedCode: http.StatusOK},
+		{name: "GetWithCookie", method: "GET", path: "/", cookieToken: "token", expectedCode: http.StatusOK, expectedToken: "token"},
+		{name: "PostWithoutCookie", method: "POST", path: "/settings", formToken: "token", expectedCode: http.StatusForbidden},
+		{name: "PostWithoutToken", method: "POST", path: "/settings", cookieToken: "token", expectedCode: http.StatusForbidden},
+		{name: "PostWithWrongToken", method: "POST", path: "/settings", cookieToken: "token", formToken: "wrong", expectedCode: http.StatusForbidden},
+		{name: "PostWithFormToken", method: "POST", path: "/settings", cookieToken: "token", formToken: "token", expectedCode: http.StatusOK, expectedToken: "token"},
+		{
+			name: "PostWithHeaderToken", method: "POST", path: "/settings", cookieToken: "token",
+			headers: map[string]string{"X-CSRF-Token": "token"}, expectedCode: http.StatusOK, expectedToken: "token",
+		},
+		{
+			name: "PostWithApiToken", method: "POST", path: "/api/v1/users/alice/snippets/2020-W01",
+			headers: map[string]string{"Authorization": "Bearer " + apiTokenPrefix + "token"}, expectedCode: http.StatusOK,
+		},
+		{
+			name: "PostWithOtherBearerToken", method: "POST", path: "/settings",
+			headers: map[string]string{"Authorization": "Bearer token"}, expectedCode: http.StatusForbidden,
+		},
+		{name: "ApiPut", method: "PUT", path: "/api/v1/users/alice/snippets/2020-W01", expectedCode: http.StatusOK},
+		{name: "ApiPost", method: "POST", path: "/api/v1/users/alice/snippets/2020-W01", expectedCode: http.StatusForbidden},
+		{name: "PublicPath", method: "POST", path: "/unsubscribe/token", expectedCode: http.StatusOK},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			form := url.Values{}
+			if test.formToken != "" {
+				form.Set("csrf_token", test.formToken)
+			}
+			req := httptest.NewRequest(test.method, test.path, strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			for name, value := range test.headers {
+				req.Header.Set(name, value)
+			}
+			if test.cookieToken != "" {
+				req.AddCookie(csrfCookie(t, sws, test.cookieToken))
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+			if recorder.Code != test.expectedCode {
+				t.Fatalf("Expected status %d, got %d: %s", test.expectedCode, recorder.Code, recorder.Body.String())
+			}
+			if test.expectedToken != "" && recorder.Body.String() != test.expectedToken+" "+test.path {
+				t.Errorf("Expected token %#v to be rendered, got %#v", test.expectedToken, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestProtectFromCsrfIssuesToken(t *testing.T) {
+	sws := newCsrfTestService()
+	handler := sws.protectFromCsrf(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if err := sws.executeTemplate(w, req, "form.html", nil); err != nil {
+			t.Error(err)
+		}
+	}))
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+	cookies := recorder.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("Expected a single cookie, got %d", len(cookies))
+	}
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(cookies[0])
+	var token string
+	if err := sws.sessions.Get(req, csrfCookieName, &token); err != nil {
+		t.Fatal(err)
+	}
+	if token == "" || recorder.Body.String() != token+" /" {
+		t.Errorf("Issued token %#v was not rendered, got %#v", token, recorder.Body.String())
+	}
+}
+
+func TestExecuteTemplateUsesCurrentRequest(t *testing.T) {
+	sws := newCsrfTestService()
+	// Rendering sequentially reuses the same copy of the templates,
+	// which needs to provide the values of each request.
+	for _, path := range []string{"/first", "/second?a=1"} {
+		req := httptest.NewRequest("GET", path, nil)
+		recorder := httptest.NewRecorder()
+		if err := sws.executeTemplate(recorder, req, "form.html", nil); err != nil {
+			t.Fatal(err)
+		}
+		if recorder.Body.String() != " "+path {
+			t.Errorf("Expected %#v, got %#v", " "+path, recorder.Body.String())
+		}
+	}
+}
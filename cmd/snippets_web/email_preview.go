@@ -0,0 +1,72 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/ProdriveTechnologies/snippets/pkg/dates"
+	"github.com/ProdriveTechnologies/snippets/pkg/emails"
+	"github.com/gorilla/mux"
+)
+
+// handleEmailPreview displays the weekly email that the current user
+// would receive for a given week, without sending it. The "week"
+// parameter selects the week, defaulting to the week for which the
+// email would be sent next.
+func (sws *SnippetsWebService) handleEmailPreview(w http.ResponseWriter, req *http.Request) {
+	kind := mux.Vars(req)["kind"]
+	week := dates.LastIsoWeek()
+	if kind == "subscriptions" {
+		week = *week.Seek(-1)
+	}
+	if parsedWeek := dates.ParseIsoWeekString(req.FormValue("week")); parsedWeek != nil {
+		week = *parsedWeek
+	}
+
+	var batch emails.Batch
+	var err error
+	if kind == "subscriptions" {
+		var subscriptions *emails.Subscriptions
+		if subscriptions, err = emails.LoadSubscriptionsOf(sws.database, sws.selfUrl, week, getCurrentUser(req)); err == nil {
+			subscriptions.Unsubscribe = sws.unsubscribeLinks
+		}
+		batch = subscriptions
+	} else {
+		batch, err = emails.LoadReminders(sws.database, sws.selfUrl, week, emails.ReminderBacklogWeeks)
+	}
+	if err != nil {
+		sws.handleErrorPage(w, req, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Display the headers that describe the email and its HTML body.
+	// The source address is only known to the cron jobs.
+	var headers []string
+	body := ""
+	user, isRecipient := batch.Recipient(getCurrentUser(req))
+	if isRecipient {
+		message, err := batch.Render(user.UserName, user.EmailAddress)
+		if err != nil {
+			sws.handleErrorPage(w, req, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		headers = message.Header()
+		body = message.HTML
+	}
+
+	if err := sws.executeTemplate(w, req, "email_preview.html", struct {
+		Kind        string
+		Week        dates.IsoWeek
+		IsRecipient bool
+		Headers     []string
+		Body        string
+	}{
+		Kind:        kind,
+		Week:        week,
+		IsRecipient: isRecipient,
+		Headers:     headers,
+		Body:        body,
+	}); err != nil {
+		log.Print(err)
+	}
+}
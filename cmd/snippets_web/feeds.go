@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/ProdriveTechnologies/snippets/pkg/dates"
+	"github.com/ProdriveTechnologies/snippets/pkg/markdown"
+	"github.com/ProdriveTechnologies/snippets/pkg/schema"
+	"github.com/ProdriveTechnologies/snippets/pkg/tokens"
+	"github.com/gorilla/mux"
+	"github.com/jinzhu/gorm"
+)
+
+// Maximum number of entries to include in a feed.
+const feedEntryLimit = 50
+
+// registerFeedRoutes adds Atom feeds to the router. As feed readers are
+// unable to authenticate through the authenticating proxy, the feeds
+// are authenticated using a per-user token that is part of the URL.
+func (sws *SnippetsWebService) registerFeedRoutes(router *mux.Router) {
+	router.HandleFunc("/feeds/{token:[A-Za-z0-9_-]+}/subscriptions.atom", sws.handleSubscriptionsFeed)
+	router.HandleFunc("/feeds/{token:[A-Za-z0-9_-]+}/users/{user_name:[a-z]+}.atom", sws.handleUserFeed)
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomPerson struct {
+	Name  string `xml:"name"`
+	Email string `xml:"email,omitempty"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+type atomEntry struct {
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Author  atomPerson  `xml:"author"`
+	Link    atomLink    `xml:"link"`
+	Content atomContent `xml:"content"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+var feedEntryContent = template.Must(template.New("content").Parse(
+	`{{if .BodyThisWeek}}
+	<h2>What has {{.RealName}} been up to this week?</h2>
+	<ul>
+		{{range .BodyThisWeek}}
+			<li>{{.}}</li>
+		{{end}}
+	</ul>
+{{end}}
+{{if .BodyNextWeek}}
+	<h2>What are {{.RealName}}'s plans for next week?</h2>
+	<ul>
+		{{range .BodyNextWeek}}
+			<li>{{.}}</li>
+		{{end}}
+	</ul>
+{{end}}`))
+
+// authenticateFeed returns the name of the user to which the token in
+// the URL of a feed belongs.
+func (sws *SnippetsWebService) authenticateFeed(w http.ResponseWriter, req *http.Request) (string, bool) {
+	var feedToken schema.FeedToken
+	if r := sws.database.Where("token_hash = ?", tokens.Hash(mux.Vars(req)["token"])).Take(&feedToken); r.Error != nil {
+		if gorm.IsRecordNotFoundError(r.Error) {
+			http.Error(w, "Invalid feed token", http.StatusForbidden)
+		} else {
+			log.Print(r.Error)
+			http.Error(w, r.Error.Error(), http.StatusInternalServerError)
+		}
+		return "", false
+	}
+	return feedToken.UserName, true
+}
+
+// getPostTimestamps returns the time at which posts were last modified.
+// Posts without revisions are considered to be modified at the end of
+// the week to which they belong.
+func (sws *SnippetsWebService) getPostTimestamps(posts []schema.Post) (map[schema.Post]time.Time, error) {
+	var userNames []string
+	for _, post := range posts {
+		userNames = append(userNames, post.UserName)
+	}
+	var revisions []schema.PostRevision
+	if r := sws.database.Table("post_revisions").Select("user_name, year, week, MAX(created_at) AS created_at").Where("user_name IN (?)", userNames).Group("user_name, year, week").Scan(&revisions); r.Error != nil {
+		return nil, r.Error
+	}
+	type postKey struct {
+		UserName string
+		Year     int
+		Week     int
+	}
+	revisionTimes := map[postKey]time.Time{}
+	for _, revision := range revisions {
+		revisionTimes[postKey{revision.UserName, revision.Year, revision.Week}] = revision.CreatedAt
+	}
+
+	timestamps := map[schema.Post]time.Time{}
+	for _, post := range posts {
+		if t, ok := revisionTimes[postKey{post.UserName, post.Year, post.Week}]; ok {
+			timestamps[post] = t
+		} else {
+			t, _ := time.Parse("2006-01-02", dates.IsoWeek{Year: post.Year, Week: post.Week}.LastDay())
+			timestamps[post] = t.Add(24*time.Hour - time.Second)
+		}
+	}
+	return timestamps, nil
+}
+
+// writeFeed renders a list of posts as an Atom feed that is read by a
+// given user.
+func (sws *SnippetsWebService) writeFeed(w http.ResponseWriter, currentUser string, title string, selfUrl string, alternateUrl string, posts []schema.Post) {
+	var userNames []string
+	for _, post := range posts {
+		userNames = append(userNames, post.UserName)
+	}
+	var users []schema.User
+	if r := sws.database.Where("user_name IN (?)", userNames).Find(&users); r.Error != nil {
+		log.Print(r.Error)
+		http.Error(w, r.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+	usersMap := map[string]schema.User{}
+	for _, user := range users {
+		usersMap[user.UserName] = user
+	}
+	timestamps, err := sws.getPostTimestamps(posts)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	feed := atomFeed{
+		Title: title,
+		ID:    alternateUrl,
+		Links: []atomLink{
+			{Href: selfUrl, Rel: "self", Type: "application/atom+xml"},
+			{Href: alternateUrl, Rel: "alternate", Type: "text/html"},
+		},
+	}
+	var updated time.Time
+	for _, post := range posts {
+		user := usersMap[post.UserName]
+		week := dates.IsoWeek{Year: post.Year, Week: post.Week}
+		readablePost := post.WithoutPrivateLinesFor(currentUser, user.Manager)
+		content := bytes.NewBuffer([]byte{})
+		if err := feedEntryContent.Execute(content, snippet{
+			UserName:     user.UserName,
+			RealName:     user.RealName,
+			BodyThisWeek: markdown.RenderPostBody(readablePost.BodyThisWeek, readablePost.IsMarkdown()),
+			BodyNextWeek: markdown.RenderPostBody(readablePost.BodyNextWeek, readablePost.IsMarkdown()),
+		}); err != nil {
+			log.Print(err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		timestamp := timestamps[post]
+		if timestamp.After(updated) {
+			updated = timestamp
+		}
+		url := fmt.Sprintf("%s%s/%s", sws.selfUrl, post.UserName, week)
+		feed.Entries = append(feed.Entries, atomEntry{
+			Title:   fmt.Sprintf("Snippets of %s for %s", user.RealName, week),
+			ID:      url,
+			Updated: timestamp.UTC().Format(time.RFC3339),
+			Author:  atomPerson{Name: user.RealName, Email: user.EmailAddress},
+			Link:    atomLink{Href: url, Rel: "alternate", Type: "text/html"},
+			Content: atomContent{Type: "html", Body: content.String()},
+		})
+	}
+	if updated.IsZero() {
+		updated = time.Now()
+	}
+	feed.Updated = updated.UTC().Format(time.RFC3339)
+
+	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	w.Write([]byte(xml.Header))
+	if err := xml.NewEncoder(w).Encode(feed); err != nil {
+		log.Print(err)
+	}
+}
+
+func (sws *SnippetsWebService) handleUserFeed(w http.ResponseWriter, req *http.Request) {
+	currentUser, ok := sws.authenticateFeed(w, req)
+	if !ok {
+		return
+	}
+
+	userName := mux.Vars(req)["user_name"]
+	var user schema.User
+	if r := sws.database.Where("user_name = ?", userName).Take(&user); r.Error != nil {
+		if gorm.IsRecordNotFoundError(r.Error) {
+			http.NotFound(w, req)
+		} else {
+			log.Print(r.Error)
+			http.Error(w, r.Error.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	db, err := sws.whereVisible(sws.database, currentUser)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var posts []schema.Post
+	if r := db.Where("user_name = ?", userName).Order("year DESC, week DESC").Limit(feedEntryLimit).Find(&posts); r.Error != nil {
+		log.Print(r.Error)
+		http.Error(w, r.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sws.writeFeed(
+		w,
+		currentUser,
+		fmt.Sprintf("Snippets of %s", user.RealName),
+		fmt.Sprintf("%sfeeds/%s/users/%s.atom", sws.selfUrl, mux.Vars(req)["token"], userName),
+		fmt.Sprintf("%s%s/%s", sws.selfUrl, userName, dates.LastIsoWeek()),
+		posts)
+}
+
+func (sws *SnippetsWebService) handleSubscriptionsFeed(w http.ResponseWriter, req *http.Request) {
+	currentUser, ok := sws.authenticateFeed(w, req)
+	if !ok {
+		return
+	}
+
+	subscribees, err := sws.getSubscribees(currentUser)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var userNames []string
+	for _, subscribee := range subscribees {
+		userNames = append(userNames, subscribee.UserName)
+	}
+	db, err := sws.whereVisible(sws.database, currentUser)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var posts []schema.Post
+	if r := db.Where("user_name IN (?)", userNames).Order("year DESC, week DESC").Limit(feedEntryLimit).Find(&posts); r.Error != nil {
+		log.Print(r.Error)
+		http.Error(w, r.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sws.writeFeed(
+		w,
+		currentUser,
+		"Snippets of people you are subscribed to",
+		fmt.Sprintf("%sfeeds/%s/subscriptions.atom", sws.selfUrl, mux.Vars(req)["token"]),
+		fmt.Sprintf("%ssubscriptions", sws.selfUrl),
+		posts)
+}
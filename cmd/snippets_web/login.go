@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/ProdriveTechnologies/snippets/pkg/oidc"
+	"github.com/ProdriveTechnologies/snippets/pkg/tokens"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// Cookie containing the identity of a user that has logged in.
+	sessionCookieName = "snippets_session"
+	// Cookie containing the state of a login that is in progress.
+	loginCookieName = "snippets_login"
+)
+
+// OidcLogin contains the configuration for letting users log in using
+// OpenID Connect, as an alternative to using an authenticating proxy.
+type OidcLogin struct {
+	Provider   *oidc.Provider
+	SessionAge time.Duration
+
+	// Names of the claims in the ID token that are mapped onto the
+	// fields of schema.User.
+	UserNameClaim     string
+	RealNameClaim     string
+	EmailAddressClaim string
+}
+
+// User names that can be used in the URLs of the pages of users.
+var validUserName = regexp.MustCompile("^[a-z]+$")
+
+type loginState struct {
+	State    string
+	Nonce    string
+	ReturnTo string
+}
+
+// registerLoginRoutes adds the pages for logging in and out. Logging out
+// is not part of /auth/, so that it is protected against cross-site
+// request forgery.
+func (sws *SnippetsWebService) registerLoginRoutes(router *mux.Router) {
+	router.HandleFunc("/auth/login", sws.handleLogin)
+	router.HandleFunc("/auth/callback", sws.handleLoginCallback)
+	router.HandleFunc("/logout", sws.handleLogout)
+}
+
+func (sws *SnippetsWebService) handleLogin(w http.ResponseWriter, req *http.Request) {
+	if sws.login == nil {
+		http.NotFound(w, req)
+		return
+	}
+
+	state, _, err := tokens.Generate()
+	if err != nil {
+		sws.handleErrorPage(w, req, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	nonce, _, err := tokens.Generate()
+	if err != nil {
+		sws.handleErrorPage(w, req, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := sws.sessions.Set(w, loginCookieName, loginState{
+		State:    state,
+		Nonce:    nonce,
+		ReturnTo: req.FormValue("return_to"),
+	}, 10*time.Minute); err != nil {
+		sws.handleErrorPage(w, req, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, req, sws.login.Provider.AuthCodeURL(state, nonce), http.StatusSeeOther)
+}
+
+func getStringClaim(claims map[string]interface{}, name string) string {
+	value, _ := claims[name].(string)
+	return value
+}
+
+func (sws *SnippetsWebService) handleLoginCallback(w http.ResponseWriter, req *http.Request) {
+	if sws.login == nil {
+		http.NotFound(w, req)
+		return
+	}
+
+	var state loginState
+	if err := sws.sessions.Get(req, loginCookieName, &state); err != nil || req.FormValue("state") != state.State {
+		sws.handleErrorPage(w, req, "Login has expired. Please try again.", http.StatusBadRequest)
+		return
+	}
+	sws.sessions.Clear(w, loginCookieName)
+	if message := req.FormValue("error"); message != "" {
+		sws.handleErrorPage(w, req, fmt.Sprintf("Login failed: %s %s", message, req.FormValue("error_description")), http.StatusUnauthorized)
+		return
+	}
+
+	claims, err := sws.login.Provider.Exchange(req.FormValue("code"), state.Nonce)
+	if err != nil {
+		sws.handleErrorPage(w, req, fmt.Sprintf("Login failed: %s", err), http.StatusUnauthorized)
+		return
+	}
+	id := identity{
+		UserName:     getStringClaim(claims, sws.login.UserNameClaim),
+		HasProfile:   true,
+		RealName:     getStringClaim(claims, sws.login.RealNameClaim),
+		EmailAddress: getStringClaim(claims, sws.login.EmailAddressClaim),
+	}
+	if id.UserName == "" {
+		sws.handleErrorPage(w, req, fmt.Sprintf("ID token does not contain claim %#v", sws.login.UserNameClaim), http.StatusUnauthorized)
+		return
+	}
+	if !validUserName.MatchString(id.UserName) {
+		sws.handleErrorPage(w, req, fmt.Sprintf("User name %#v provided by claim %#v is invalid, as user names may only consist of lowercase letters. Please ask your administrator to configure -oidc.claim.user_name to use a different claim.", id.UserName, sws.login.UserNameClaim), http.StatusUnauthorized)
+		return
+	}
+	if err := sws.createOrUpdateUser(withIdentity(req, id)); err != nil {
+		sws.handleErrorPage(w, req, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := sws.sessions.Set(w, sessionCookieName, id, sws.login.SessionAge); err != nil {
+		sws.handleErrorPage(w, req, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, req, sws.getReturnUrl(state.ReturnTo, "/"), http.StatusSeeOther)
+}
+
+func (sws *SnippetsWebService) handleLogout(w http.ResponseWriter, req *http.Request) {
+	if sws.login == nil {
+		http.NotFound(w, req)
+		return
+	}
+	if req.Method != "POST" {
+		sws.handleErrorPage(w, req, "Expected POST request", http.StatusMethodNotAllowed)
+		return
+	}
+
+	sws.sessions.Clear(w, sessionCookieName)
+	if err := sws.executeTemplate(w, req, "logged_out.html", nil); err != nil {
+		log.Print(err)
+	}
+}
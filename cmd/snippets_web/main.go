@@ -1,11 +1,19 @@
 package main
 
 import (
+	"crypto/rand"
 	"flag"
 	"html/template"
 	"log"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/ProdriveTechnologies/snippets/pkg/emails"
+	"github.com/ProdriveTechnologies/snippets/pkg/jwt"
+	"github.com/ProdriveTechnologies/snippets/pkg/mail"
+	"github.com/ProdriveTechnologies/snippets/pkg/oidc"
+	"github.com/ProdriveTechnologies/snippets/pkg/session"
 	"github.com/ProdriveTechnologies/snippets/pkg/util"
 	"github.com/gorilla/mux"
 	"github.com/jinzhu/gorm"
@@ -14,18 +22,119 @@ import (
 )
 
 func main() {
+	senderFlags := mail.RegisterSenderFlags(flag.CommandLine)
+	workerFlags := mail.RegisterWorkerFlags(flag.CommandLine)
 	var (
-		dbAddress   = flag.String("db.address", "", "Database server address.")
-		snippetsUrl = flag.String("snippets.url", "", "URL of the Snippets site.")
+		dbAddress              = flag.String("db.address", "", "Database server address.")
+		oidcClaimEmailAddress  = flag.String("oidc.claim.email_address", "email", "ID token claim containing the user's email address.")
+		oidcClaimRealName      = flag.String("oidc.claim.real_name", "name", "ID token claim containing the user's real name.")
+		oidcClaimUserName      = flag.String("oidc.claim.user_name", "preferred_username", "ID token claim containing the user's username.")
+		oidcClientID           = flag.String("oidc.client_id", "", "OpenID Connect client ID.")
+		oidcClientSecret       = flag.String("oidc.client_secret", "", "OpenID Connect client secret.")
+		oidcIssuer             = flag.String("oidc.issuer", "", "OpenID Connect issuer URL. If set, users log in using OpenID Connect instead of being authenticated by a proxy.")
+		proxyAssertionAudience = flag.String("proxy.assertion_audience", "", "Required audience of identity assertions.")
+		proxyAssertionClaim    = flag.String("proxy.assertion_claim", "sub", "Claim of identity assertions that must match X-Auth-Subject.")
+		proxyAssertionHeader   = flag.String("proxy.assertion_header", "", "Header containing a JSON Web Token asserting the identity of the user. Assertions are not required if empty.")
+		proxyAssertionIssuer   = flag.String("proxy.assertion_issuer", "", "Required issuer of identity assertions.")
+		proxyAssertionJwksUrl  = flag.String("proxy.assertion_jwks_url", "", "URL of the key set used to verify identity assertions.")
+		proxyAssertionSecret   = flag.String("proxy.assertion_secret", "", "Secret used to verify identity assertions signed using HMAC, instead of a key set.")
+		proxySecret            = flag.String("proxy.secret", "", "Secret that the authenticating proxy provides in the header specified by -proxy.secret_header.")
+		proxySecretHeader      = flag.String("proxy.secret_header", "", "Header containing a secret shared with the authenticating proxy. Secrets are not required if empty.")
+		proxyTrustedNetworks   = flag.String("proxy.trusted_networks", "", "Comma separated list of CIDRs from which the authenticating proxy connects. Connections from any address are accepted if empty.")
+		sessionKey             = flag.String("session.key", "", "Secret for signing session and CSRF cookies. If empty, a random secret is used, causing users to be logged out on restart.")
+		sessionMaxAge          = flag.Duration("session.max_age", 12*time.Hour, "Duration after which users need to log in again.")
+		snippetsUrl            = flag.String("snippets.url", "", "URL of the Snippets site.")
+		unsubscribeKey         = flag.String("unsubscribe.key", "", "Secret shared with snippets_cron_subscriptions for signing unsubscribe links. Unsubscribe links are rejected if empty.")
 	)
 	flag.Parse()
+	sender, err := senderFlags.NewSender()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if sender.Smarthost != "" && sender.From == "" {
+		log.Fatal("Sending emails requires a source email address to be provided using -smtp.from")
+	}
+
+	key := []byte(*sessionKey)
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			panic(err)
+		}
+	}
+	sessions := &session.Store{
+		Key:    key,
+		Secure: strings.HasPrefix(*snippetsUrl, "https://"),
+	}
+
+	var login *OidcLogin
+	if *oidcIssuer != "" {
+		provider, err := oidc.Discover(*oidcIssuer, *oidcClientID, *oidcClientSecret, *snippetsUrl+"auth/callback")
+		if err != nil {
+			panic(err)
+		}
+		login = &OidcLogin{
+			Provider:          provider,
+			SessionAge:        *sessionMaxAge,
+			UserNameClaim:     *oidcClaimUserName,
+			RealNameClaim:     *oidcClaimRealName,
+			EmailAddressClaim: *oidcClaimEmailAddress,
+		}
+	}
+
+	networks, err := ParseNetworks(*proxyTrustedNetworks)
+	if err != nil {
+		panic(err)
+	}
+	proxyTrust := &ProxyTrust{
+		Networks:              networks,
+		SecretHeader:          *proxySecretHeader,
+		Secret:                *proxySecret,
+		AssertionHeader:       *proxyAssertionHeader,
+		AssertionIssuer:       *proxyAssertionIssuer,
+		AssertionAudience:     *proxyAssertionAudience,
+		AssertionSubjectClaim: *proxyAssertionClaim,
+	}
+	if *proxySecretHeader != "" && *proxySecret == "" {
+		log.Fatal("Requiring a proxy secret using -proxy.secret_header requires -proxy.secret")
+	}
+	if *proxyAssertionHeader != "" && *proxyAssertionSecret == "" && *proxyAssertionJwksUrl == "" {
+		log.Fatal("Verifying identity assertions requires either -proxy.assertion_secret or -proxy.assertion_jwks_url")
+	}
+	if *proxyAssertionSecret != "" {
+		proxyTrust.AssertionKeys = func(header jwt.Header) (interface{}, error) {
+			return []byte(*proxyAssertionSecret), nil
+		}
+	} else {
+		proxyTrust.AssertionKeys = (&jwt.RemoteKeySet{
+			URL:    *proxyAssertionJwksUrl,
+			Client: &http.Client{Timeout: 10 * time.Second},
+		}).Key
+	}
 
 	db, err := gorm.Open("postgres", *dbAddress)
 	if err != nil {
 		panic(err)
 	}
 
-	templates, err := template.ParseGlob("templates/*")
+	// Emails are added to the outbound mail queue, which is also used
+	// by the cron jobs. Queued emails are sent in the background.
+	// Notifications are disabled if no smarthost is configured.
+	var mailQueue mail.Transport
+	if sender.Smarthost != "" {
+		mailQueue = &mail.Queue{DB: db}
+		go workerFlags.NewWorker(db, sender).Run(30 * time.Second)
+	}
+
+	var unsubscribeLinks *emails.UnsubscribeLinks
+	if *unsubscribeKey != "" {
+		unsubscribeLinks = &emails.UnsubscribeLinks{
+			SnippetsUrl: *snippetsUrl,
+			Key:         []byte(*unsubscribeKey),
+		}
+	}
+
+	templates, err := template.New("").Funcs(templateFuncs).ParseGlob("templates/*")
 	if err != nil {
 		panic(err)
 	}
@@ -34,6 +143,6 @@ func main() {
 	router.Handle("/metrics", promhttp.Handler())
 	util.RegisterHealthPage(db, router)
 	router.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(http.Dir("./static/"))))
-	NewSnippetsWebService(db, templates, *snippetsUrl, router)
+	NewSnippetsWebService(db, templates, *snippetsUrl, mailQueue, sender.From, unsubscribeLinks, sessions, login, proxyTrust, router)
 	log.Fatal(http.ListenAndServe(":80", router))
 }
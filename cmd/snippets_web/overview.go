@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/ProdriveTechnologies/snippets/pkg/dates"
+	"github.com/ProdriveTechnologies/snippets/pkg/schema"
+	"github.com/gorilla/mux"
+)
+
+// getSubscribees returns all users that a user is subscribed to, either
+// directly or through subscriptions to teams, sorted by real name.
+func (sws *SnippetsWebService) getSubscribees(userName string) ([]schema.User, error) {
+	var subscriptions []schema.Subscription
+	if r := sws.database.Where("subscriber = ?", userName).Find(&subscriptions); r.Error != nil {
+		return nil, r.Error
+	}
+	var teamSubscriptions []schema.TeamSubscription
+	if r := sws.database.Where("subscriber = ?", userName).Find(&teamSubscriptions); r.Error != nil {
+		return nil, r.Error
+	}
+	var teamNames []string
+	for _, teamSubscription := range teamSubscriptions {
+		teamNames = append(teamNames, teamSubscription.TeamName)
+	}
+	var teamMembers []schema.TeamMember
+	if r := sws.database.Where("team_name IN (?)", teamNames).Find(&teamMembers); r.Error != nil {
+		return nil, r.Error
+	}
+
+	var subscribees []string
+	for _, subscription := range subscriptions {
+		subscribees = append(subscribees, subscription.Subscribee)
+	}
+	for _, teamMember := range teamMembers {
+		if teamMember.UserName != userName {
+			subscribees = append(subscribees, teamMember.UserName)
+		}
+	}
+	var users []schema.User
+	if r := sws.database.Where("user_name IN (?)", subscribees).Order("real_name").Find(&users); r.Error != nil {
+		return nil, r.Error
+	}
+	return users, nil
+}
+
+func (sws *SnippetsWebService) handleSubscriptionsLandingPage(w http.ResponseWriter, req *http.Request) {
+	http.Redirect(w, req, fmt.Sprintf("%ssubscriptions/%s", sws.selfUrl, *dates.LastIsoWeek().Seek(-1)), http.StatusSeeOther)
+}
+
+// handleSubscriptionsView displays the snippets of everyone the current
+// user is subscribed to on a single page.
+func (sws *SnippetsWebService) handleSubscriptionsView(w http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	week := dates.ParseIsoWeek(vars["year"], vars["week"])
+	if week == nil {
+		http.NotFound(w, req)
+		return
+	}
+
+	currentUser := getCurrentUser(req)
+	subscribees, err := sws.getSubscribees(currentUser)
+	if err != nil {
+		sws.handleErrorPage(w, req, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	snippets, didNotWriteSnippets, err := sws.getSnippets(subscribees, *week, currentUser)
+	if err != nil {
+		sws.handleErrorPage(w, req, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := sws.executeTemplate(w, req, "subscriptions_view.html", struct {
+		Subscribees         []schema.User
+		PreviousWeek        *dates.IsoWeek
+		CurrentWeek         dates.IsoWeek
+		CurrentWeekFirstDay string
+		CurrentWeekLastDay  string
+		NextWeek            *dates.IsoWeek
+		LastWeek            dates.IsoWeek
+		Snippets            []snippet
+		DidNotWriteSnippets []schema.User
+	}{
+		Subscribees:         subscribees,
+		PreviousWeek:        week.Seek(-1),
+		CurrentWeek:         *week,
+		CurrentWeekFirstDay: week.FirstDay(),
+		CurrentWeekLastDay:  week.LastDay(),
+		NextWeek:            week.Seek(1),
+		LastWeek:            dates.LastIsoWeek(),
+		Snippets:            snippets,
+		DidNotWriteSnippets: didNotWriteSnippets,
+	}); err != nil {
+		log.Print(err)
+	}
+}
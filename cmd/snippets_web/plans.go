@@ -0,0 +1,365 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ProdriveTechnologies/snippets/pkg/dates"
+	"github.com/ProdriveTechnologies/snippets/pkg/markdown"
+	"github.com/ProdriveTechnologies/snippets/pkg/schema"
+	"github.com/gorilla/mux"
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	// Number of weeks displayed by the plans report by default.
+	planReportWeeks = 12
+	// Maximum number of weeks displayed by the plans report.
+	maxPlanReportWeeks = 104
+	// Number of weeks after which a plan that is carried over is
+	// listed separately by the plans report.
+	longCarriedPlanWeeks = 2
+)
+
+// getPlans returns the plans that a user has written for a week, being
+// the lines of Markdown of the preceding week's BodyNextWeek.
+func (sws *SnippetsWebService) getPlans(userName string, week dates.IsoWeek) ([]string, error) {
+	previousWeek := week.Seek(-1)
+	if previousWeek == nil {
+		return nil, nil
+	}
+	var post schema.Post
+	if r := sws.database.Where("user_name = ? AND year = ? AND week = ?", userName, previousWeek.Year, previousWeek.Week).Take(&post); r.Error != nil {
+		if gorm.IsRecordNotFoundError(r.Error) {
+			return nil, nil
+		}
+		return nil, r.Error
+	}
+	return markdown.SplitLines(toMarkdown(post.BodyNextWeek, post.IsMarkdown())), nil
+}
+
+// getPendingPlans returns the plans that a user has written for a week,
+// if no outcomes have been recorded for them yet.
+func (sws *SnippetsWebService) getPendingPlans(userName string, week dates.IsoWeek) ([]string, error) {
+	var count int
+	if r := sws.database.Model(&schema.PlanOutcome{}).Where("user_name = ? AND year = ? AND week = ?", userName, week.Year, week.Week).Count(&count); r.Error != nil {
+		return nil, r.Error
+	}
+	if count > 0 {
+		return nil, nil
+	}
+	return sws.getPlans(userName, week)
+}
+
+// getCarriedOverPlans returns the outcomes of the plans for a week that
+// were carried over from the week before, in the order in which they
+// were written.
+func (sws *SnippetsWebService) getCarriedOverPlans(userName string, week dates.IsoWeek) ([]schema.PlanOutcome, error) {
+	previousWeek := week.Seek(-1)
+	if previousWeek == nil {
+		return nil, nil
+	}
+	var outcomes []schema.PlanOutcome
+	if r := sws.database.Where("user_name = ? AND year = ? AND week = ? AND outcome = ?", userName, previousWeek.Year, previousWeek.Week, schema.PlanOutcomeCarriedOver).Order("position").Find(&outcomes); r.Error != nil {
+		return nil, r.Error
+	}
+	return outcomes, nil
+}
+
+// matchCarriedOverPlans returns, for every plan, the outcome of the
+// carried over plan from which it originates, if any. Plans are matched
+// by their contents. As carried over plans are placed at the top of
+// the next week's plans, plans that have been edited since are matched
+// by their position instead.
+func matchCarriedOverPlans(plans []string, carriedOver []schema.PlanOutcome) []*schema.PlanOutcome {
+	matches := make([]*schema.PlanOutcome, len(plans))
+	byPlan := map[string]int{}
+	for i, outcome := range carriedOver {
+		byPlan[outcome.Plan] = i
+	}
+	matched := make([]bool, len(carriedOver))
+	for i, plan := range plans {
+		if j, ok := byPlan[plan]; ok && !matched[j] {
+			matches[i] = &carriedOver[j]
+			matched[j] = true
+		}
+	}
+	for i := range plans {
+		if i < len(carriedOver) && matches[i] == nil && !matched[i] {
+			matches[i] = &carriedOver[i]
+			matched[i] = true
+		}
+	}
+	return matches
+}
+
+// handlePlansImport creates a snippet for an empty week out of the
+// plans written in the previous week. Every plan is either marked done,
+// carried over to next week or dropped. These outcomes are recorded, so
+// that they can be displayed by the plans report.
+func (sws *SnippetsWebService) handlePlansImport(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		sws.handleErrorPage(w, req, "Expected POST request", http.StatusMethodNotAllowed)
+		return
+	}
+
+	vars := mux.Vars(req)
+	week := dates.ParseIsoWeek(vars["year"], vars["week"])
+	if week == nil {
+		http.NotFound(w, req)
+		return
+	}
+	userName := vars["user_name"]
+	if userName != getCurrentUser(req) {
+		sws.handleErrorPage(w, req, "Snippets from other users cannot be edited", http.StatusForbidden)
+		return
+	}
+
+	plans, err := sws.getPlans(userName, *week)
+	if err != nil {
+		sws.handleErrorPage(w, req, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	carriedOver, err := sws.getCarriedOverPlans(userName, *week)
+	if err != nil {
+		sws.handleErrorPage(w, req, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	previousOutcomes := matchCarriedOverPlans(plans, carriedOver)
+	var done, toCarryOver []string
+	var outcomes []schema.PlanOutcome
+	for i, plan := range plans {
+		outcome := req.FormValue(fmt.Sprintf("plan_%d", i))
+		if !schema.IsValidPlanOutcome(outcome) {
+			sws.handleErrorPage(w, req, "Invalid plan outcome", http.StatusBadRequest)
+			return
+		}
+		switch outcome {
+		case schema.PlanOutcomeDone:
+			done = append(done, plan)
+		case schema.PlanOutcomeCarriedOver:
+			toCarryOver = append(toCarryOver, plan)
+		}
+		carriedWeeks := 0
+		if previous := previousOutcomes[i]; previous != nil {
+			carriedWeeks = previous.CarriedWeeks + 1
+		}
+		outcomes = append(outcomes, schema.PlanOutcome{
+			UserName:     userName,
+			Year:         week.Year,
+			Week:         week.Week,
+			Position:     i,
+			Plan:         plan,
+			Outcome:      outcome,
+			CarriedWeeks: carriedWeeks,
+		})
+	}
+	expectedVersion, err := strconv.Atoi(req.FormValue("version"))
+	if err != nil {
+		sws.handleErrorPage(w, req, "Invalid snippet version", http.StatusBadRequest)
+		return
+	}
+	if err := sws.savePlanOutcomes(req, userName, *week, strings.Join(done, "\n"), strings.Join(toCarryOver, "\n"), outcomes, expectedVersion); err == errPostConflict {
+		sws.handleErrorPage(w, req, "Your snippet has been written in the meantime. Please go back, reload the page and try again.", http.StatusConflict)
+		return
+	} else if err != nil {
+		sws.handleErrorPage(w, req, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, req, fmt.Sprintf("%s%s/%s", sws.selfUrl, userName, week), http.StatusSeeOther)
+}
+
+// savePlanOutcomes stores the snippet created by importing plans,
+// together with the outcomes of the plans, replacing any outcomes that
+// were recorded before. It returns errPostConflict if a snippet has
+// been written for the week.
+func (sws *SnippetsWebService) savePlanOutcomes(req *http.Request, userName string, week dates.IsoWeek, bodyThisWeek string, bodyNextWeek string, outcomes []schema.PlanOutcome, expectedVersion int) error {
+	if err := sws.createOrUpdateUser(req); err != nil {
+		return err
+	}
+
+	tx := sws.database.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+	// Plans may only be imported into an empty week, so that a snippet
+	// that has been written already is never overwritten.
+	var existing int
+	if r := tx.Model(&schema.Post{}).Where("user_name = ? AND year = ? AND week = ?", userName, week.Year, week.Week).Count(&existing); r.Error != nil {
+		tx.Rollback()
+		return r.Error
+	} else if existing > 0 {
+		tx.Rollback()
+		return errPostConflict
+	}
+	if _, err := savePostInTransaction(tx, getCurrentUser(req), userName, week, bodyThisWeek, bodyNextWeek, "", expectedVersion); err != nil {
+		tx.Rollback()
+		return asPostConflict(err)
+	}
+	if r := tx.Where("user_name = ? AND year = ? AND week = ?", userName, week.Year, week.Week).Delete(&schema.PlanOutcome{}); r.Error != nil {
+		tx.Rollback()
+		return r.Error
+	}
+	for _, outcome := range outcomes {
+		if r := tx.Create(&outcome); r.Error != nil {
+			tx.Rollback()
+			return r.Error
+		}
+	}
+	return asPostConflict(tx.Commit().Error)
+}
+
+// planStatistics contains the number of plans with each of the
+// outcomes, either for a single week or for all weeks in a report.
+type planStatistics struct {
+	Week        dates.IsoWeek
+	Done        int
+	CarriedOver int
+	Dropped     int
+}
+
+func (ps *planStatistics) add(outcome string) {
+	switch outcome {
+	case schema.PlanOutcomeDone:
+		ps.Done++
+	case schema.PlanOutcomeCarriedOver:
+		ps.CarriedOver++
+	case schema.PlanOutcomeDropped:
+		ps.Dropped++
+	}
+}
+
+func (ps planStatistics) Total() int {
+	return ps.Done + ps.CarriedOver + ps.Dropped
+}
+
+// CompletionRate returns the percentage of plans that have been
+// carried out.
+func (ps planStatistics) CompletionRate() int {
+	if ps.Total() == 0 {
+		return 0
+	}
+	return 100 * ps.Done / ps.Total()
+}
+
+// longCarriedPlan is a plan that has been carried over for multiple
+// weeks, along with its latest outcome.
+type longCarriedPlan struct {
+	Plan         template.HTML
+	Week         dates.IsoWeek
+	Outcome      string
+	CarriedWeeks int
+}
+
+// handlePlansReport displays how many of the plans of a user have been
+// carried out over a range of weeks. As plans may be confidential, the
+// report can only be accessed by the user and their manager.
+func (sws *SnippetsWebService) handlePlansReport(w http.ResponseWriter, req *http.Request) {
+	userName := mux.Vars(req)["user_name"]
+	var user schema.User
+	if r := sws.database.Where("user_name = ?", userName).Take(&user); r.Error != nil {
+		if gorm.IsRecordNotFoundError(r.Error) {
+			http.NotFound(w, req)
+		} else {
+			sws.handleErrorPage(w, req, r.Error.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	if currentUser := getCurrentUser(req); currentUser != userName && (user.Manager == "" || currentUser != user.Manager) {
+		sws.handleErrorPage(w, req, "Plans of other users can only be accessed by their manager", http.StatusForbidden)
+		return
+	}
+
+	to := dates.LastIsoWeek()
+	if week := dates.ParseIsoWeekString(req.FormValue("to")); week != nil {
+		to = *week
+	}
+	from := to
+	if week := to.Seek(1 - planReportWeeks); week != nil {
+		from = *week
+	}
+	if week := dates.ParseIsoWeekString(req.FormValue("from")); week != nil {
+		from = *week
+	}
+	if to.Before(from) {
+		from, to = to, from
+	}
+	if earliest := to.Seek(1 - maxPlanReportWeeks); earliest != nil && from.Before(*earliest) {
+		from = *earliest
+	}
+
+	var outcomes []schema.PlanOutcome
+	if r := sws.database.Where("user_name = ?", userName).Where(
+		"year > ? OR (year = ? AND week >= ?)", from.Year, from.Year, from.Week).Where(
+		"year < ? OR (year = ? AND week <= ?)", to.Year, to.Year, to.Week).Order("year, week, position").Find(&outcomes); r.Error != nil {
+		sws.handleErrorPage(w, req, r.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Compute statistics per week and for the report as a whole.
+	var weeks []*planStatistics
+	total := planStatistics{}
+	latestOutcomes := map[string]schema.PlanOutcome{}
+	for _, outcome := range outcomes {
+		week := dates.IsoWeek{Year: outcome.Year, Week: outcome.Week}
+		if len(weeks) == 0 || weeks[len(weeks)-1].Week != week {
+			weeks = append(weeks, &planStatistics{Week: week})
+		}
+		weeks[len(weeks)-1].add(outcome.Outcome)
+		total.add(outcome.Outcome)
+		latestOutcomes[outcome.Plan] = outcome
+	}
+
+	// List plans that have been carried over for multiple weeks, based
+	// on the most recent outcome of every plan.
+	var longCarriedPlans []longCarriedPlan
+	for _, outcome := range latestOutcomes {
+		carriedWeeks := outcome.CarriedWeeks
+		if outcome.Outcome == schema.PlanOutcomeCarriedOver {
+			carriedWeeks++
+		}
+		if carriedWeeks >= longCarriedPlanWeeks {
+			longCarriedPlans = append(longCarriedPlans, longCarriedPlan{
+				Plan:         markdown.Render(outcome.Plan),
+				Week:         dates.IsoWeek{Year: outcome.Year, Week: outcome.Week},
+				Outcome:      outcome.Outcome,
+				CarriedWeeks: carriedWeeks,
+			})
+		}
+	}
+	sort.Slice(longCarriedPlans, func(i int, j int) bool {
+		a, b := longCarriedPlans[i], longCarriedPlans[j]
+		if a.CarriedWeeks != b.CarriedWeeks {
+			return a.CarriedWeeks > b.CarriedWeeks
+		}
+		if a.Week.Year != b.Week.Year {
+			return a.Week.Year > b.Week.Year
+		}
+		return a.Week.Week > b.Week.Week
+	})
+
+	if err := sws.executeTemplate(w, req, "plans_report.html", struct {
+		UserName         string
+		RealName         string
+		From             dates.IsoWeek
+		To               dates.IsoWeek
+		Weeks            []*planStatistics
+		Total            planStatistics
+		LongCarriedPlans []longCarriedPlan
+	}{
+		UserName:         userName,
+		RealName:         user.RealName,
+		From:             from,
+		To:               to,
+		Weeks:            weeks,
+		Total:            total,
+		LongCarriedPlans: longCarriedPlans,
+	}); err != nil {
+		log.Print(err)
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/ProdriveTechnologies/snippets/pkg/schema"
+)
+
+func TestMatchCarriedOverPlans(t *testing.T) {
+	carriedOver := []schema.PlanOutcome{
+		{Position: 1, Plan: "Write report", CarriedWeeks: 0},
+		{Position: 3, Plan: "Fix build", CarriedWeeks: 2},
+	}
+	for _, test := range []struct {
+		name  string
+		plans []string
+		want  []int
+	}{
+		{"Unchanged", []string{"Write report", "Fix build", "New plan"}, []int{0, 2, -1}},
+		{"Reordered", []string{"Fix build", "Write report"}, []int{2, 0}},
+		{"Edited", []string{"Write final report", "Fix build", "New plan"}, []int{0, 2, -1}},
+		{"Removed", []string{"Fix build"}, []int{2}},
+		{"Replaced", []string{"New plan"}, []int{0}},
+		{"Empty", nil, []int{}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			matches := matchCarriedOverPlans(test.plans, carriedOver)
+			if len(matches) != len(test.want) {
+				t.Fatalf("Expected %d matches, got %d", len(test.want), len(matches))
+			}
+			for i, match := range matches {
+				got := -1
+				if match != nil {
+					got = match.CarriedWeeks
+				}
+				if got != test.want[i] {
+					t.Errorf("Plan %d: expected carried weeks %d, got %d", i, test.want[i], got)
+				}
+			}
+		})
+	}
+}
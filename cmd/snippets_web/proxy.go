@@ -0,0 +1,122 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ProdriveTechnologies/snippets/pkg/jwt"
+)
+
+// ProxyTrust contains the checks that a request needs to pass before
+// the identity headers set by the authenticating proxy are trusted.
+// Checks whose configuration is left empty are skipped.
+type ProxyTrust struct {
+	// Networks from which the proxy connects.
+	Networks []*net.IPNet
+
+	// Header containing a secret that is only known by the proxy.
+	SecretHeader string
+	Secret       string
+
+	// Header containing a JSON Web Token signed by the proxy or its
+	// identity provider, of which a claim must match X-Auth-Subject.
+	AssertionHeader       string
+	AssertionKeys         jwt.KeyFunc
+	AssertionIssuer       string
+	AssertionAudience     string
+	AssertionSubjectClaim string
+}
+
+// ParseNetworks parses a comma separated list of CIDRs.
+func ParseNetworks(list string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, cidr := range strings.Split(list, ",") {
+		if cidr = strings.TrimSpace(cidr); cidr == "" {
+			continue
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+func (pt *ProxyTrust) verifyNetwork(req *http.Request) error {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	for _, network := range pt.Networks {
+		if network.Contains(ip) {
+			return nil
+		}
+	}
+	return fmt.Errorf("Request originates from untrusted address %s", host)
+}
+
+func (pt *ProxyTrust) verifyAssertion(req *http.Request) error {
+	assertion := strings.TrimPrefix(req.Header.Get(pt.AssertionHeader), "Bearer ")
+	if assertion == "" {
+		return errors.New("Request contains no identity assertion")
+	}
+	var payload json.RawMessage
+	if err := jwt.Verify(assertion, pt.AssertionKeys, &payload); err != nil {
+		return err
+	}
+	var registeredClaims jwt.Claims
+	if err := json.Unmarshal(payload, &registeredClaims); err != nil {
+		return err
+	}
+	var claims map[string]interface{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return err
+	}
+	if err := registeredClaims.Validate(pt.AssertionIssuer, pt.AssertionAudience, time.Now()); err != nil {
+		return err
+	}
+	if subject, _ := claims[pt.AssertionSubjectClaim].(string); subject != req.Header.Get("X-Auth-Subject") {
+		return errors.New("Identity assertion does not match X-Auth-Subject")
+	}
+	return nil
+}
+
+// Verify that a request has been forwarded by a trusted proxy.
+func (pt *ProxyTrust) Verify(req *http.Request) error {
+	if len(pt.Networks) > 0 {
+		if err := pt.verifyNetwork(req); err != nil {
+			return err
+		}
+	}
+	if pt.SecretHeader != "" {
+		secret := req.Header.Get(pt.SecretHeader)
+		if secret == "" || pt.Secret == "" || subtle.ConstantTimeCompare([]byte(secret), []byte(pt.Secret)) != 1 {
+			return errors.New("Request contains an invalid proxy secret")
+		}
+	}
+	if pt.AssertionHeader != "" {
+		if err := pt.verifyAssertion(req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hasIdentityHeaders returns whether a request claims to be performed
+// on behalf of a user by the authenticating proxy.
+func hasIdentityHeaders(req *http.Request) bool {
+	for _, header := range []string{"X-Auth-Subject", "X-Auth-Name", "X-Auth-Email"} {
+		if req.Header.Get(header) != "" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ProdriveTechnologies/snippets/pkg/jwt"
+)
+
+var assertionKey = []byte("assertion key")
+
+// newAssertion creates an identity assertion signed using HS256.
+func newAssertion(t *testing.T, claims map[string]interface{}) string {
+	encode := func(value interface{}) string {
+		data, err := json.Marshal(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	signingInput := encode(jwt.Header{Algorithm: "HS256"}) + "." + encode(claims)
+	mac := hmac.New(sha256.New, assertionKey)
+	mac.Write([]byte(signingInput))
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// assertionTrust returns a ProxyTrust that requires identity
+// assertions signed using assertionKey.
+func assertionTrust(keys jwt.KeyFunc) ProxyTrust {
+	return ProxyTrust{
+		AssertionHeader:       "Authorization",
+		AssertionKeys:         keys,
+		AssertionIssuer:       "https://idp.example.com",
+		AssertionAudience:     "snippets",
+		AssertionSubjectClaim: "preferred_username",
+	}
+}
+
+func TestParseNetworks(t *testing.T) {
+	networks, err := ParseNetworks(" 10.0.0.0/8, ,fd00::/8,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(networks) != 2 || networks[0].String() != "10.0.0.0/8" || networks[1].String() != "fd00::/8" {
+		t.Errorf("Unexpected networks %v", networks)
+	}
+	if _, err := ParseNetworks("10.0.0.0"); err == nil {
+		t.Error("Network without prefix length was accepted")
+	}
+}
+
+func TestProxyTrustVerify(t *testing.T) {
+	networks, err := ParseNetworks("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := func(header jwt.Header) (interface{}, error) { return assertionKey, nil }
+	validClaims := map[string]interface{}{
+		"iss":                "https://idp.example.com",
+		"aud":                "snippets",
+		"exp":                time.Now().Add(time.Hour).Unix(),
+		"preferred_username": "alice",
+	}
+	expiredClaims := map[string]interface{}{}
+	otherSubjectClaims := map[string]interface{}{}
+	for name, value := range validClaims {
+		expiredClaims[name] = value
+		otherSubjectClaims[name] = value
+	}
+	expiredClaims["exp"] = time.Now().Add(-time.Hour).Unix()
+	otherSubjectClaims["preferred_username"] = "bob"
+
+	for _, test := range []struct {
+		name       string
+		trust      ProxyTrust
+		remoteAddr string
+		headers    map[string]string
+		valid      bool
+	}{
+		{"NoChecks", ProxyTrust{}, "192.0.2.1:1234", nil, true},
+		{"TrustedNetwork", ProxyTrust{Networks: networks}, "10.1.2.3:1234", nil, true},
+		{"UntrustedNetwork", ProxyTrust{Networks: networks}, "192.0.2.1:1234", nil, false},
+		{"InvalidRemoteAddr", ProxyTrust{Networks: networks}, "10.1.2.3", nil, false},
+		{
+			"ValidSecret", ProxyTrust{SecretHeader: "X-Proxy-Secret", Secret: "secret"}, "192.0.2.1:1234",
+			map[string]string{"X-Proxy-Secret": "secret"}, true,
+		},
+		{
+			"InvalidSecret", ProxyTrust{SecretHeader: "X-Proxy-Secret", Secret: "secret"}, "192.0.2.1:1234",
+			map[string]string{"X-Proxy-Secret": "wrong"}, false,
+		},
+		{"MissingSecret", ProxyTrust{SecretHeader: "X-Proxy-Secret", Secret: "secret"}, "192.0.2.1:1234", nil, false},
+		{
+			"EmptyConfiguredSecret", ProxyTrust{SecretHeader: "X-Proxy-Secret"}, "192.0.2.1:1234",
+			map[string]string{"X-Proxy-Secret": ""}, false,
+		},
+		{
+			"ValidAssertion", assertionTrust(keys), "192.0.2.1:1234",
+			map[string]string{"X-Auth-Subject": "alice", "Authorization": "Bearer " + newAssertion(t, validClaims)}, true,
+		},
+		{
+			"ExpiredAssertion", assertionTrust(keys), "192.0.2.1:1234",
+			map[string]string{"X-Auth-Subject": "alice", "Authorization": "Bearer " + newAssertion(t, expiredClaims)}, false,
+		},
+		{
+			"MismatchingSubject", assertionTrust(keys), "192.0.2.1:1234",
+			map[string]string{"X-Auth-Subject": "alice", "Authorization": "Bearer " + newAssertion(t, otherSubjectClaims)}, false,
+		},
+		{
+			"TamperedAssertion", assertionTrust(keys), "192.0.2.1:1234",
+			map[string]string{"X-Auth-Subject": "alice", "Authorization": "Bearer " + newAssertion(t, validClaims) + "x"}, false,
+		},
+		{"MissingAssertion", assertionTrust(keys), "192.0.2.1:1234", map[string]string{"X-Auth-Subject": "alice"}, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = test.remoteAddr
+			for name, value := range test.headers {
+				req.Header.Set(name, value)
+			}
+			if err := test.trust.Verify(req); (err == nil) != test.valid {
+				t.Errorf("Expected valid: %v, got error %v", test.valid, err)
+			}
+		})
+	}
+}
+
+func TestHasIdentityHeaders(t *testing.T) {
+	for header, expected := range map[string]bool{
+		"X-Auth-Subject": true,
+		"X-Auth-Name":    true,
+		"X-Auth-Email":   true,
+		"X-Other":        false,
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(header, "value")
+		if hasIdentityHeaders(req) != expected {
+			t.Errorf("Request with header %s: expected %v", header, expected)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ProdriveTechnologies/snippets/pkg/dates"
+	"github.com/ProdriveTechnologies/snippets/pkg/diff"
+	"github.com/ProdriveTechnologies/snippets/pkg/markdown"
+	"github.com/ProdriveTechnologies/snippets/pkg/schema"
+	"github.com/gorilla/mux"
+	"github.com/jinzhu/gorm"
+)
+
+// getRevisionWeek extracts the user and week from the URL of one of
+// the revision pages. Revisions may only be accessed by their author.
+func (sws *SnippetsWebService) getRevisionWeek(w http.ResponseWriter, req *http.Request) (string, *dates.IsoWeek) {
+	vars := mux.Vars(req)
+	week := dates.ParseIsoWeek(vars["year"], vars["week"])
+	if week == nil {
+		http.NotFound(w, req)
+		return "", nil
+	}
+
+	userName := vars["user_name"]
+	if userName != getCurrentUser(req) {
+		sws.handleErrorPage(w, req, "Revisions of snippets from other users cannot be accessed", http.StatusForbidden)
+		return "", nil
+	}
+	return userName, week
+}
+
+func (sws *SnippetsWebService) getRevision(userName string, week dates.IsoWeek, revision int) (schema.PostRevision, error) {
+	var postRevision schema.PostRevision
+	err := sws.database.Where("user_name = ? AND year = ? AND week = ? AND revision = ?", userName, week.Year, week.Week, revision).Take(&postRevision).Error
+	return postRevision, err
+}
+
+func (sws *SnippetsWebService) handleRevisionList(w http.ResponseWriter, req *http.Request) {
+	userName, week := sws.getRevisionWeek(w, req)
+	if week == nil {
+		return
+	}
+
+	var revisions []schema.PostRevision
+	if r := sws.database.Where("user_name = ? AND year = ? AND week = ?", userName, week.Year, week.Week).Order("revision DESC").Find(&revisions); r.Error != nil {
+		sws.handleErrorPage(w, req, r.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := sws.executeTemplate(w, req, "revision_list.html", struct {
+		UserName  string
+		Week      dates.IsoWeek
+		Revisions []schema.PostRevision
+	}{
+		UserName:  userName,
+		Week:      *week,
+		Revisions: revisions,
+	}); err != nil {
+		log.Print(err)
+	}
+}
+
+func (sws *SnippetsWebService) handleRevisionView(w http.ResponseWriter, req *http.Request) {
+	userName, week := sws.getRevisionWeek(w, req)
+	if week == nil {
+		return
+	}
+
+	revisionNumber, _ := strconv.Atoi(mux.Vars(req)["revision"])
+	revision, err := sws.getRevision(userName, *week, revisionNumber)
+	if err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			http.NotFound(w, req)
+		} else {
+			sws.handleErrorPage(w, req, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// By default, compare against the preceding revision. Another
+	// revision may be selected explicitly.
+	baseNumber := revisionNumber - 1
+	if compare := req.FormValue("compare"); compare != "" {
+		if n, err := strconv.Atoi(compare); err == nil {
+			baseNumber = n
+		}
+	}
+	var base schema.PostRevision
+	if baseNumber >= 1 && baseNumber != revisionNumber {
+		if base, err = sws.getRevision(userName, *week, baseNumber); err != nil && !gorm.IsRecordNotFoundError(err) {
+			sws.handleErrorPage(w, req, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	var latest schema.PostRevision
+	if r := sws.database.Where("user_name = ? AND year = ? AND week = ?", userName, week.Year, week.Week).Order("revision DESC").Take(&latest); r.Error != nil {
+		sws.handleErrorPage(w, req, r.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := sws.executeTemplate(w, req, "revision_view.html", struct {
+		UserName     string
+		Week         dates.IsoWeek
+		Revision     schema.PostRevision
+		Base         schema.PostRevision
+		IsLatest     bool
+		DiffThisWeek []diff.Line
+		DiffNextWeek []diff.Line
+	}{
+		UserName:     userName,
+		Week:         *week,
+		Revision:     revision,
+		Base:         base,
+		IsLatest:     revision.Revision == latest.Revision,
+		DiffThisWeek: diff.Lines(markdown.SplitLines(base.BodyThisWeek), markdown.SplitLines(revision.BodyThisWeek)),
+		DiffNextWeek: diff.Lines(markdown.SplitLines(base.BodyNextWeek), markdown.SplitLines(revision.BodyNextWeek)),
+	}); err != nil {
+		log.Print(err)
+	}
+}
+
+// toMarkdown converts the body of a revision to Markdown, so that it
+// can be stored again. Revisions created before Markdown support was
+// added are escaped.
+func toMarkdown(body string, isMarkdown bool) string {
+	if isMarkdown {
+		return body
+	}
+	var lines []string
+	for _, line := range markdown.SplitLines(body) {
+		lines = append(lines, markdown.Escape(line))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (sws *SnippetsWebService) handleRevisionRestore(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		sws.handleErrorPage(w, req, "Expected POST request", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userName, week := sws.getRevisionWeek(w, req)
+	if week == nil {
+		return
+	}
+
+	revisionNumber, _ := strconv.Atoi(mux.Vars(req)["revision"])
+	revision, err := sws.getRevision(userName, *week, revisionNumber)
+	if err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			http.NotFound(w, req)
+		} else {
+			sws.handleErrorPage(w, req, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	isMarkdown := revision.Format == schema.PostFormatMarkdown
+	if _, err := sws.savePost(req, userName, *week, toMarkdown(revision.BodyThisWeek, isMarkdown), toMarkdown(revision.BodyNextWeek, isMarkdown), "", anyPostVersion); err != nil {
+		sws.handleErrorPage(w, req, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, req, fmt.Sprintf("%s%s/%s", sws.selfUrl, userName, week), http.StatusSeeOther)
+}
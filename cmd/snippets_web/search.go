@@ -0,0 +1,173 @@
+package main
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/ProdriveTechnologies/snippets/pkg/dates"
+	"github.com/ProdriveTechnologies/snippets/pkg/markdown"
+	"github.com/ProdriveTechnologies/snippets/pkg/schema"
+	"github.com/ProdriveTechnologies/snippets/pkg/search"
+)
+
+const (
+	// Maximum number of posts to rank for a single query.
+	searchCandidateLimit = 1000
+	// Maximum number of posts to scan for candidates, which may exceed
+	// the number of candidates if posts only match through private
+	// lines that the user may not read.
+	searchScanLimit = 10 * searchCandidateLimit
+	// Maximum number of results to return for a single query.
+	searchResultLimit = 100
+)
+
+// parseSearchQuery obtains a search query from the "q" parameter. The
+// "user", "from" and "to" parameters may be used to override the
+// filters contained in the query string.
+func parseSearchQuery(req *http.Request) search.Query {
+	query := search.ParseQuery(req.FormValue("q"))
+	if userName := req.FormValue("user"); userName != "" {
+		query.UserName = userName
+	}
+	if week := dates.ParseIsoWeekString(req.FormValue("from")); week != nil {
+		query.From = week
+	}
+	if week := dates.ParseIsoWeekString(req.FormValue("to")); week != nil {
+		query.To = week
+	}
+	return query
+}
+
+// searchPosts returns the posts that match a query and may be read by
+// a user.
+func (sws *SnippetsWebService) searchPosts(query search.Query, userName string) ([]search.Result, error) {
+	if len(query.Terms) == 0 {
+		return []search.Result{}, nil
+	}
+
+	db, err := sws.whereVisible(sws.database, userName)
+	if err != nil {
+		return nil, err
+	}
+	for _, word := range query.Words() {
+		pattern := "%" + search.EscapeLikePattern(word) + "%"
+		db = db.Where("LOWER(body_this_week) LIKE ? OR LOWER(body_next_week) LIKE ?", pattern, pattern)
+	}
+	if query.UserName != "" {
+		db = db.Where("user_name = ?", query.UserName)
+	}
+	if query.From != nil {
+		db = db.Where("year > ? OR (year = ? AND week >= ?)", query.From.Year, query.From.Year, query.From.Week)
+	}
+	if query.To != nil {
+		db = db.Where("year < ? OR (year = ? AND week <= ?)", query.To.Year, query.To.Year, query.To.Week)
+	}
+
+	// The database only checks for the words of the query, as terms
+	// may be interrupted by Markdown formatting. Private lines are
+	// removed before matching the terms, so that posts that only match
+	// through private lines are not returned. Posts that don't match
+	// don't count towards the number of candidates.
+	var candidates []schema.Post
+	for offset := 0; offset < searchScanLimit && len(candidates) < searchCandidateLimit; offset += searchCandidateLimit {
+		var posts []schema.Post
+		if r := db.Order("year DESC, week DESC, user_name").Offset(offset).Limit(searchCandidateLimit).Find(&posts); r.Error != nil {
+			return nil, r.Error
+		}
+		readablePosts, err := sws.withoutPrivateLines(posts, userName)
+		if err != nil {
+			return nil, err
+		}
+		for _, post := range readablePosts {
+			if len(candidates) < searchCandidateLimit && search.Matches(post, query) {
+				candidates = append(candidates, post)
+			}
+		}
+		if len(posts) < searchCandidateLimit {
+			break
+		}
+	}
+	return search.Rank(candidates, query, searchResultLimit), nil
+}
+
+func (sws *SnippetsWebService) handleSearch(w http.ResponseWriter, req *http.Request) {
+	query := parseSearchQuery(req)
+	results, err := sws.searchPosts(query, getCurrentUser(req))
+	if err != nil {
+		sws.handleErrorPage(w, req, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Obtain real names of the authors of the results.
+	var userNames []string
+	for _, result := range results {
+		userNames = append(userNames, result.Post.UserName)
+	}
+	var users []schema.User
+	if r := sws.database.Where("user_name IN (?)", userNames).Find(&users); r.Error != nil {
+		sws.handleErrorPage(w, req, r.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+	realNames := map[string]string{}
+	for _, user := range users {
+		realNames[user.UserName] = user.RealName
+	}
+
+	type Result struct {
+		search.Result
+		RealName        string
+		MatchesThisWeek []template.HTML
+		MatchesNextWeek []template.HTML
+	}
+	var namedResults []Result
+	for _, result := range results {
+		isMarkdown := result.Post.IsMarkdown()
+		namedResults = append(namedResults, Result{
+			Result:          result,
+			RealName:        realNames[result.Post.UserName],
+			MatchesThisWeek: markdown.RenderPostBody(strings.Join(result.MatchesThisWeek, "\n"), isMarkdown),
+			MatchesNextWeek: markdown.RenderPostBody(strings.Join(result.MatchesNextWeek, "\n"), isMarkdown),
+		})
+	}
+
+	from, to := "", ""
+	if query.From != nil {
+		from = query.From.String()
+	}
+	if query.To != nil {
+		to = query.To.String()
+	}
+	if err := sws.executeTemplate(w, req, "search.html", struct {
+		Query    string
+		UserName string
+		From     string
+		To       string
+		Searched bool
+		Results  []Result
+	}{
+		Query:    req.FormValue("q"),
+		UserName: query.UserName,
+		From:     from,
+		To:       to,
+		Searched: len(query.Terms) > 0,
+		Results:  namedResults,
+	}); err != nil {
+		log.Print(err)
+	}
+}
+
+func (sws *SnippetsWebService) handleApiSearch(w http.ResponseWriter, req *http.Request) {
+	query := parseSearchQuery(req)
+	if len(query.Terms) == 0 {
+		handleApiError(w, "Search query contains no terms", http.StatusBadRequest)
+		return
+	}
+	results, err := sws.searchPosts(query, getCurrentUser(req))
+	if err != nil {
+		handleApiError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeApiResponse(w, results, http.StatusOK)
+}
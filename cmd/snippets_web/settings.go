@@ -0,0 +1,250 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ProdriveTechnologies/snippets/pkg/schema"
+	"github.com/ProdriveTechnologies/snippets/pkg/tokens"
+	"github.com/gorilla/mux"
+	"github.com/jinzhu/gorm"
+)
+
+// renderSettings displays the settings page. Tokens that have just been
+// generated are passed in, as they cannot be recovered afterwards.
+func (sws *SnippetsWebService) renderSettings(w http.ResponseWriter, req *http.Request, feedToken string, apiToken string) {
+	currentUser := getCurrentUser(req)
+	var existingFeedToken schema.FeedToken
+	hasFeedToken := true
+	if r := sws.database.Where("user_name = ?", currentUser).Take(&existingFeedToken); r.Error != nil {
+		if !gorm.IsRecordNotFoundError(r.Error) {
+			sws.handleErrorPage(w, req, r.Error.Error(), http.StatusInternalServerError)
+			return
+		}
+		hasFeedToken = false
+	}
+	defaultVisibility, err := getDefaultVisibility(sws.database, currentUser)
+	if err != nil {
+		sws.handleErrorPage(w, req, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var user schema.User
+	if r := sws.database.Where("user_name = ?", currentUser).Take(&user); r.Error != nil && !gorm.IsRecordNotFoundError(r.Error) {
+		sws.handleErrorPage(w, req, r.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+	var apiTokens []schema.ApiToken
+	if r := sws.database.Where("user_name = ?", currentUser).Order("created_at").Find(&apiTokens); r.Error != nil {
+		sws.handleErrorPage(w, req, r.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := sws.executeTemplate(w, req, "settings.html", struct {
+		SnippetsUrl        string
+		UserName           string
+		DefaultVisibility  string
+		Manager            string
+		ChatWebhookUrl     string
+		ChatReminders      bool
+		ChatSubscriptions  bool
+		HasFeedToken       bool
+		FeedTokenCreatedAt time.Time
+		FeedToken          string
+		ApiTokens          []schema.ApiToken
+		ApiToken           string
+		CanLogOut          bool
+	}{
+		SnippetsUrl:        sws.selfUrl,
+		UserName:           currentUser,
+		DefaultVisibility:  defaultVisibility,
+		Manager:            user.Manager,
+		ChatWebhookUrl:     user.ChatWebhookUrl,
+		ChatReminders:      user.ChatReminders,
+		ChatSubscriptions:  user.ChatSubscriptions,
+		HasFeedToken:       hasFeedToken,
+		FeedTokenCreatedAt: existingFeedToken.CreatedAt,
+		FeedToken:          feedToken,
+		ApiTokens:          apiTokens,
+		ApiToken:           apiToken,
+		CanLogOut:          sws.login != nil,
+	}); err != nil {
+		log.Print(err)
+	}
+}
+
+func (sws *SnippetsWebService) handleSettings(w http.ResponseWriter, req *http.Request) {
+	sws.renderSettings(w, req, "", "")
+}
+
+// handleDefaultVisibilityChange changes the visibility that is used
+// for snippets that the current user creates.
+func (sws *SnippetsWebService) handleDefaultVisibilityChange(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		sws.handleErrorPage(w, req, "Expected POST request", http.StatusMethodNotAllowed)
+		return
+	}
+
+	visibility := req.FormValue("visibility")
+	if !schema.IsValidVisibility(visibility) {
+		sws.handleErrorPage(w, req, "Invalid snippet visibility", http.StatusBadRequest)
+		return
+	}
+	if err := sws.createOrUpdateUser(req); err != nil {
+		sws.handleErrorPage(w, req, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if r := sws.database.Model(&schema.User{UserName: getCurrentUser(req)}).Update("default_visibility", visibility); r.Error != nil {
+		sws.handleErrorPage(w, req, r.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, req, fmt.Sprintf("%ssettings", sws.selfUrl), http.StatusSeeOther)
+}
+
+// handleManagerChange changes the manager of the current user, who is
+// permitted to read the private lines of the user's snippets.
+func (sws *SnippetsWebService) handleManagerChange(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		sws.handleErrorPage(w, req, "Expected POST request", http.StatusMethodNotAllowed)
+		return
+	}
+
+	currentUser := getCurrentUser(req)
+	manager := strings.TrimSpace(req.FormValue("manager"))
+	if manager == currentUser {
+		sws.handleErrorPage(w, req, "You cannot be your own manager", http.StatusBadRequest)
+		return
+	}
+	if manager != "" {
+		if r := sws.database.Where("user_name = ?", manager).Take(&schema.User{}); r.Error != nil {
+			if gorm.IsRecordNotFoundError(r.Error) {
+				sws.handleErrorPage(w, req, fmt.Sprintf("User %#v does not exist", manager), http.StatusBadRequest)
+			} else {
+				sws.handleErrorPage(w, req, r.Error.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+	}
+	if err := sws.createOrUpdateUser(req); err != nil {
+		sws.handleErrorPage(w, req, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if r := sws.database.Model(&schema.User{UserName: currentUser}).Update("manager", manager); r.Error != nil {
+		sws.handleErrorPage(w, req, r.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, req, fmt.Sprintf("%ssettings", sws.selfUrl), http.StatusSeeOther)
+}
+
+// handleChatChange changes the chat webhook of the current user and
+// which of the weekly emails are delivered through it.
+func (sws *SnippetsWebService) handleChatChange(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		sws.handleErrorPage(w, req, "Expected POST request", http.StatusMethodNotAllowed)
+		return
+	}
+
+	webhookUrl := strings.TrimSpace(req.FormValue("webhook_url"))
+	if webhookUrl != "" {
+		if u, err := url.Parse(webhookUrl); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			sws.handleErrorPage(w, req, "Invalid chat webhook URL", http.StatusBadRequest)
+			return
+		}
+	}
+	if err := sws.createOrUpdateUser(req); err != nil {
+		sws.handleErrorPage(w, req, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if r := sws.database.Model(&schema.User{UserName: getCurrentUser(req)}).Updates(map[string]interface{}{
+		"chat_webhook_url":   webhookUrl,
+		"chat_reminders":     req.FormValue("reminders") != "",
+		"chat_subscriptions": req.FormValue("subscriptions") != "",
+	}); r.Error != nil {
+		sws.handleErrorPage(w, req, r.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, req, fmt.Sprintf("%ssettings", sws.selfUrl), http.StatusSeeOther)
+}
+
+// handleFeedTokenCreate generates a new feed token for the current
+// user, invalidating any previous one. As only its hash is stored, the
+// token is displayed exactly once.
+func (sws *SnippetsWebService) handleFeedTokenCreate(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		sws.handleErrorPage(w, req, "Expected POST request", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token, hash, err := tokens.Generate()
+	if err != nil {
+		sws.handleErrorPage(w, req, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := sws.createOrUpdateUser(req); err != nil {
+		sws.handleErrorPage(w, req, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if r := sws.database.Save(&schema.FeedToken{
+		UserName:  getCurrentUser(req),
+		TokenHash: hash,
+		CreatedAt: time.Now(),
+	}); r.Error != nil {
+		sws.handleErrorPage(w, req, r.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+	sws.renderSettings(w, req, token, "")
+}
+
+// handleApiTokenCreate generates a new API token for the current user.
+// Like feed tokens, it is displayed exactly once.
+func (sws *SnippetsWebService) handleApiTokenCreate(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		sws.handleErrorPage(w, req, "Expected POST request", http.StatusMethodNotAllowed)
+		return
+	}
+
+	description := strings.TrimSpace(req.FormValue("description"))
+	if description == "" {
+		sws.handleErrorPage(w, req, "API tokens require a description", http.StatusBadRequest)
+		return
+	}
+	token, _, err := tokens.Generate()
+	if err != nil {
+		sws.handleErrorPage(w, req, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	token = apiTokenPrefix + token
+	hash := tokens.Hash(token)
+	if err := sws.createOrUpdateUser(req); err != nil {
+		sws.handleErrorPage(w, req, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if r := sws.database.Create(&schema.ApiToken{
+		UserName:    getCurrentUser(req),
+		Description: description,
+		TokenHash:   hash,
+		CreatedAt:   time.Now(),
+	}); r.Error != nil {
+		sws.handleErrorPage(w, req, r.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+	sws.renderSettings(w, req, "", token)
+}
+
+func (sws *SnippetsWebService) handleApiTokenRevoke(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		sws.handleErrorPage(w, req, "Expected POST request", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, _ := strconv.ParseInt(mux.Vars(req)["id"], 10, 64)
+	if r := sws.database.Where("id = ? AND user_name = ?", id, getCurrentUser(req)).Delete(&schema.ApiToken{}); r.Error != nil {
+		sws.handleErrorPage(w, req, r.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, req, fmt.Sprintf("%ssettings", sws.selfUrl), http.StatusSeeOther)
+}
@@ -1,47 +1,87 @@
 package main
 
 import (
+	"errors"
 	"fmt"
-	"html"
 	"html/template"
 	"log"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/ProdriveTechnologies/snippets/pkg/dates"
+	"github.com/ProdriveTechnologies/snippets/pkg/emails"
+	"github.com/ProdriveTechnologies/snippets/pkg/mail"
+	"github.com/ProdriveTechnologies/snippets/pkg/markdown"
 	"github.com/ProdriveTechnologies/snippets/pkg/schema"
+	"github.com/ProdriveTechnologies/snippets/pkg/session"
 	"github.com/gorilla/mux"
 	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
 )
 
 type SnippetsWebService struct {
-	database  *gorm.DB
-	templates *template.Template
-	selfUrl   string
+	database         *gorm.DB
+	templates        *template.Template
+	selfUrl          string
+	mailSender       mail.Transport
+	mailFrom         string
+	unsubscribeLinks *emails.UnsubscribeLinks
+	sessions         *session.Store
+	login            *OidcLogin
+	proxyTrust       *ProxyTrust
+	templateSets     sync.Pool
 }
 
-func NewSnippetsWebService(database *gorm.DB, templates *template.Template, selfUrl string, router *mux.Router) *SnippetsWebService {
+func NewSnippetsWebService(database *gorm.DB, templates *template.Template, selfUrl string, mailSender mail.Transport, mailFrom string, unsubscribeLinks *emails.UnsubscribeLinks, sessions *session.Store, login *OidcLogin, proxyTrust *ProxyTrust, router *mux.Router) *SnippetsWebService {
 	sws := &SnippetsWebService{
-		database:  database,
-		templates: templates,
-		selfUrl:   selfUrl,
+		database:         database,
+		templates:        templates,
+		selfUrl:          selfUrl,
+		mailSender:       mailSender,
+		mailFrom:         mailFrom,
+		unsubscribeLinks: unsubscribeLinks,
+		sessions:         sessions,
+		login:            login,
+		proxyTrust:       proxyTrust,
 	}
+	router.Use(sws.authenticate, sws.protectFromCsrf)
+	sws.registerLoginRoutes(router)
+	sws.registerApiRoutes(router)
 	router.HandleFunc("/", sws.handleLandingPage)
 	router.HandleFunc("/others", sws.handleOthersList)
+	router.HandleFunc("/search", sws.handleSearch)
+	router.HandleFunc("/subscriptions", sws.handleSubscriptionsLandingPage)
+	router.HandleFunc("/subscriptions/{year:[0-9]{4}}-W{week:[0-9]{2}}", sws.handleSubscriptionsView)
+	sws.registerTeamRoutes(router)
+	sws.registerFeedRoutes(router)
+	sws.registerUnsubscribeRoutes(router)
+	router.HandleFunc("/settings", sws.handleSettings)
+	router.HandleFunc("/settings/default_visibility", sws.handleDefaultVisibilityChange)
+	router.HandleFunc("/settings/manager", sws.handleManagerChange)
+	router.HandleFunc("/settings/chat", sws.handleChatChange)
+	router.HandleFunc("/settings/emails/{kind:subscriptions|reminders}", sws.handleEmailPreview)
+	router.HandleFunc("/settings/feed_token", sws.handleFeedTokenCreate)
+	router.HandleFunc("/settings/api_tokens", sws.handleApiTokenCreate)
+	router.HandleFunc("/settings/api_tokens/{id:[0-9]+}/revoke", sws.handleApiTokenRevoke)
 	router.HandleFunc("/{user_name:[a-z]+}/{year:[0-9]{4}}-W{week:[0-9]{2}}", sws.handleSnippetView)
+	router.HandleFunc("/{user_name:[a-z]+}/{year:[0-9]{4}}-W{week:[0-9]{2}}/comments", sws.handleCommentCreate)
+	router.HandleFunc("/{user_name:[a-z]+}/{year:[0-9]{4}}-W{week:[0-9]{2}}/plans", sws.handlePlansImport)
+	router.HandleFunc("/{user_name:[a-z]+}/{year:[0-9]{4}}-W{week:[0-9]{2}}/revisions", sws.handleRevisionList)
+	router.HandleFunc("/{user_name:[a-z]+}/{year:[0-9]{4}}-W{week:[0-9]{2}}/revisions/{revision:[0-9]+}", sws.handleRevisionView)
+	router.HandleFunc("/{user_name:[a-z]+}/{year:[0-9]{4}}-W{week:[0-9]{2}}/revisions/{revision:[0-9]+}/restore", sws.handleRevisionRestore)
+	router.HandleFunc("/{user_name:[a-z]+}/plans", sws.handlePlansReport)
 	router.HandleFunc("/{user_name:[a-z]+}/subscribe", sws.handleSubscribe)
 	router.HandleFunc("/{user_name:[a-z]+}/unsubscribe", sws.handleUnsubscribe)
 	return sws
 }
 
-func getCurrentUser(req *http.Request) string {
-	return req.Header.Get("X-Auth-Subject")
-}
-
 func (sws *SnippetsWebService) handleErrorPage(w http.ResponseWriter, req *http.Request, message string, code int) {
 	log.Print(message)
 	w.WriteHeader(code)
-	if err := sws.templates.ExecuteTemplate(w, "error.html", struct {
+	if err := sws.executeTemplate(w, req, "error.html", struct {
 		Message string
 	}{
 		Message: message,
@@ -50,6 +90,16 @@ func (sws *SnippetsWebService) handleErrorPage(w http.ResponseWriter, req *http.
 	}
 }
 
+// getReturnUrl converts a path provided by the client into a URL that
+// can safely be redirected to, preventing redirects to other sites.
+// The fallback path is used if the provided path is invalid.
+func (sws *SnippetsWebService) getReturnUrl(path string, fallback string) string {
+	if !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "//") || strings.Contains(path, "\\") {
+		path = fallback
+	}
+	return sws.selfUrl + strings.TrimPrefix(path, "/")
+}
+
 func (sws *SnippetsWebService) handleLandingPage(w http.ResponseWriter, req *http.Request) {
 	http.Redirect(w, req, fmt.Sprintf("%s%s/%s", sws.selfUrl, getCurrentUser(req), dates.LastIsoWeek()), http.StatusSeeOther)
 }
@@ -61,7 +111,7 @@ func (sws *SnippetsWebService) handleOthersList(w http.ResponseWriter, req *http
 		return
 	}
 
-	if err := sws.templates.ExecuteTemplate(w, "others.html", struct {
+	if err := sws.executeTemplate(w, req, "others.html", struct {
 		Users    []schema.User
 		LastWeek dates.IsoWeek
 	}{
@@ -73,38 +123,27 @@ func (sws *SnippetsWebService) handleOthersList(w http.ResponseWriter, req *http
 }
 
 func (sws *SnippetsWebService) createOrUpdateUser(req *http.Request) error {
+	id := getIdentity(req)
+	if !id.HasProfile {
+		return sws.database.FirstOrCreate(&schema.User{
+			UserName: id.UserName,
+		}).Error
+	}
 	return sws.database.Assign(schema.User{
-		RealName:     req.Header.Get("X-Auth-Name"),
-		EmailAddress: req.Header.Get("X-Auth-Email"),
+		RealName:     id.RealName,
+		EmailAddress: id.EmailAddress,
 	}).FirstOrCreate(&schema.User{
-		UserName: getCurrentUser(req),
+		UserName: id.UserName,
 	}).Error
 }
 
 // Converts HTML code submitted by the snippet edit form into a list of
-// plain-text strings.
+// lines of Markdown.
 func extractListElementsFromHtml(code string) string {
-	// Turn HTML tags into newlines.
-	suppress := false
-	out := ""
-	for _, c := range code {
-		switch c {
-		case '<':
-			suppress = true
-			out += "\n"
-		case '>':
-			suppress = false
-		default:
-			if !suppress {
-				out += string(c)
-			}
-		}
-	}
-
 	// Remove empty lines and unnecessary whitespace from the input.
 	var lines []string
-	for _, line := range strings.Split(out, "\n") {
-		line = strings.Join(strings.Fields(html.UnescapeString(line)), " ")
+	for _, line := range strings.Split(markdown.FromHtml(code), "\n") {
+		line = strings.Join(strings.Fields(line), " ")
 		if line != "" {
 			lines = append(lines, line)
 		}
@@ -112,60 +151,243 @@ func extractListElementsFromHtml(code string) string {
 	return strings.Join(lines, "\n")
 }
 
-func (sws *SnippetsWebService) handleSnippetEdit(w http.ResponseWriter, req *http.Request) {
-	vars := mux.Vars(req)
-	week := dates.ParseIsoWeek(vars["year"], vars["week"])
-	if week == nil {
-		http.NotFound(w, req)
-		return
+// Value for the expected version of a post that disables optimistic
+// concurrency control.
+const anyPostVersion = -1
+
+// errPostConflict is returned by savePost when the post was modified
+// after the version on which the changes were based.
+var errPostConflict = errors.New("Snippet has been modified in the meantime")
+
+// asPostConflict converts errors caused by concurrently saving the same
+// post to errPostConflict. Both saves pass the version check, after
+// which storing the same revision twice either violates the primary key
+// of the revisions or causes the transaction to fail to serialize.
+func asPostConflict(err error) error {
+	if pqErr, ok := err.(*pq.Error); ok && (pqErr.Code == "23505" || pqErr.Code == "40001") {
+		return errPostConflict
 	}
+	return err
+}
 
-	userName := vars["user_name"]
-	if userName != getCurrentUser(req) {
-		sws.handleErrorPage(w, req, "Snippets from other users cannot be edited", http.StatusForbidden)
-		return
+// Stores the contents of a snippet. The snippet is deleted when both
+// bodies are empty, as the database does not permit storing empty posts.
+// Every change is recorded as a revision, so that it can be undone.
+// Changes are only stored if the current version of the snippet is
+// equal to expectedVersion. The new version is returned. The visibility
+// of the snippet is left unchanged if none is provided.
+func (sws *SnippetsWebService) savePost(req *http.Request, userName string, week dates.IsoWeek, bodyThisWeek string, bodyNextWeek string, visibility string, expectedVersion int) (int, error) {
+	if err := sws.createOrUpdateUser(req); err != nil {
+		return 0, err
 	}
 
-	req.ParseForm()
-	bodyThisWeek := extractListElementsFromHtml(req.Form.Get("body_this_week"))
-	bodyNextWeek := extractListElementsFromHtml(req.Form.Get("body_next_week"))
+	tx := sws.database.Begin()
+	if tx.Error != nil {
+		return 0, tx.Error
+	}
+	version, err := savePostInTransaction(tx, getCurrentUser(req), userName, week, bodyThisWeek, bodyNextWeek, visibility, expectedVersion)
+	if err != nil {
+		tx.Rollback()
+		return 0, asPostConflict(err)
+	}
+	return version, asPostConflict(tx.Commit().Error)
+}
+
+// getPostVersion returns the version of a post, being the number of its
+// latest revision. Posts that are deleted retain their version, so that
+// recreating them cannot be confused with an earlier version.
+func getPostVersion(db *gorm.DB, userName string, week dates.IsoWeek) (int, error) {
+	var latest schema.PostRevision
+	if r := db.Where("user_name = ? AND year = ? AND week = ?", userName, week.Year, week.Week).Order("revision DESC").Take(&latest); r.Error != nil {
+		if gorm.IsRecordNotFoundError(r.Error) {
+			return 0, nil
+		}
+		return 0, r.Error
+	}
+	return latest.Revision, nil
+}
+
+// getPostVersions returns the versions of all posts of a user, indexed
+// by week.
+func getPostVersions(db *gorm.DB, userName string) (map[dates.IsoWeek]int, error) {
+	rows, err := db.Model(&schema.PostRevision{}).Select("year, week, MAX(revision)").Where("user_name = ?", userName).Group("year, week").Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	versions := map[dates.IsoWeek]int{}
+	for rows.Next() {
+		var week dates.IsoWeek
+		var version int
+		if err := rows.Scan(&week.Year, &week.Week, &version); err != nil {
+			return nil, err
+		}
+		versions[week] = version
+	}
+	return versions, rows.Err()
+}
+
+func savePostInTransaction(tx *gorm.DB, author string, userName string, week dates.IsoWeek, bodyThisWeek string, bodyNextWeek string, visibility string, expectedVersion int) (int, error) {
+	var post schema.Post
+	postExists := true
+	if r := tx.Where("user_name = ? AND year = ? AND week = ?", userName, week.Year, week.Week).Take(&post); r.Error != nil {
+		if !gorm.IsRecordNotFoundError(r.Error) {
+			return 0, r.Error
+		}
+		postExists = false
+	}
+	version, err := getPostVersion(tx, userName, week)
+	if err != nil {
+		return 0, err
+	}
+	if expectedVersion != anyPostVersion && expectedVersion != version {
+		return 0, errPostConflict
+	}
+
+	// Posts written before revisions were tracked. Store the original
+	// contents as the first revision.
+	if version == 0 && postExists {
+		version = 1
+		if r := tx.Create(&schema.PostRevision{
+			UserName:     userName,
+			Year:         week.Year,
+			Week:         week.Week,
+			Revision:     version,
+			Author:       userName,
+			CreatedAt:    time.Now(),
+			BodyThisWeek: post.BodyThisWeek,
+			BodyNextWeek: post.BodyNextWeek,
+			Format:       post.Format,
+		}); r.Error != nil {
+			return 0, r.Error
+		}
+	}
+
+	newVersion := version + 1
 	if bodyThisWeek == "" && bodyNextWeek == "" {
 		// No body provided. Delete the snippet if one exists.
-		if r := sws.database.Where("user_name = ? AND year = ?  AND week = ?", userName, week.Year, week.Week).Delete(&schema.Post{}); r.Error != nil {
-			sws.handleErrorPage(w, req, r.Error.Error(), http.StatusInternalServerError)
-			return
+		if !postExists {
+			return version, nil
+		}
+		if r := tx.Where("user_name = ? AND year = ?  AND week = ?", userName, week.Year, week.Week).Delete(&schema.Post{}); r.Error != nil {
+			return 0, r.Error
 		}
 	} else {
-		// Create or update the snippet.
-		if err := sws.createOrUpdateUser(req); err != nil {
-			sws.handleErrorPage(w, req, err.Error(), http.StatusInternalServerError)
-			return
+		// Create or update the snippet. New snippets obtain the
+		// author's default visibility.
+		if visibility == "" {
+			if postExists {
+				visibility = post.Visibility
+			} else if visibility, err = getDefaultVisibility(tx, userName); err != nil {
+				return 0, err
+			}
 		}
-
-		if r := sws.database.Assign(map[string]string{
+		if postExists && post.BodyThisWeek == bodyThisWeek && post.BodyNextWeek == bodyNextWeek && post.IsMarkdown() && post.Visibility == visibility {
+			return version, nil
+		}
+		if r := tx.Assign(map[string]interface{}{
 			"body_this_week": bodyThisWeek,
 			"body_next_week": bodyNextWeek,
+			"format":         schema.PostFormatMarkdown,
+			"visibility":     visibility,
 		}).FirstOrCreate(&schema.Post{
 			UserName: userName,
 			Year:     week.Year,
 			Week:     week.Week,
 		}); r.Error != nil {
-			sws.handleErrorPage(w, req, r.Error.Error(), http.StatusInternalServerError)
-			return
+			return 0, r.Error
 		}
 	}
 
-	http.Redirect(w, req, req.Referer(), http.StatusSeeOther)
+	return newVersion, tx.Create(&schema.PostRevision{
+		UserName:     userName,
+		Year:         week.Year,
+		Week:         week.Week,
+		Revision:     newVersion,
+		Author:       author,
+		CreatedAt:    time.Now(),
+		BodyThisWeek: bodyThisWeek,
+		BodyNextWeek: bodyNextWeek,
+		Format:       schema.PostFormatMarkdown,
+	}).Error
 }
 
-func splitLines(input string) []string {
-	var lines []string
-	for _, line := range strings.Split(input, "\n") {
-		if line != "" {
-			lines = append(lines, line)
-		}
+func (sws *SnippetsWebService) handleSnippetEdit(w http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	week := dates.ParseIsoWeek(vars["year"], vars["week"])
+	if week == nil {
+		http.NotFound(w, req)
+		return
+	}
+
+	userName := vars["user_name"]
+	if userName != getCurrentUser(req) {
+		sws.handleErrorPage(w, req, "Snippets from other users cannot be edited", http.StatusForbidden)
+		return
+	}
+
+	req.ParseForm()
+	bodyThisWeek := extractListElementsFromHtml(req.Form.Get("body_this_week"))
+	bodyNextWeek := extractListElementsFromHtml(req.Form.Get("body_next_week"))
+	expectedVersion, err := strconv.Atoi(req.Form.Get("version"))
+	if err != nil {
+		sws.handleErrorPage(w, req, "Invalid snippet version", http.StatusBadRequest)
+		return
+	}
+	visibility := req.Form.Get("visibility")
+	if visibility != "" && !schema.IsValidVisibility(visibility) {
+		sws.handleErrorPage(w, req, "Invalid snippet visibility", http.StatusBadRequest)
+		return
+	}
+	if _, err := sws.savePost(req, userName, *week, bodyThisWeek, bodyNextWeek, visibility, expectedVersion); err == errPostConflict {
+		sws.handleSnippetConflict(w, req, userName, *week, bodyThisWeek, bodyNextWeek, visibility)
+		return
+	} else if err != nil {
+		sws.handleErrorPage(w, req, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, req, sws.getReturnUrl(req.Form.Get("return_to"), fmt.Sprintf("/%s/%s", userName, week)), http.StatusSeeOther)
+}
+
+// handleSnippetConflict displays both the submitted and the currently
+// stored version of a snippet after an edit is rejected, so that the
+// user can merge them. Saving the merged version overwrites the stored
+// version.
+func (sws *SnippetsWebService) handleSnippetConflict(w http.ResponseWriter, req *http.Request, userName string, week dates.IsoWeek, bodyThisWeek string, bodyNextWeek string, visibility string) {
+	var post schema.Post
+	if r := sws.database.Where("user_name = ? AND year = ? AND week = ?", userName, week.Year, week.Week).Take(&post); r.Error != nil && !gorm.IsRecordNotFoundError(r.Error) {
+		sws.handleErrorPage(w, req, r.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+	version, err := getPostVersion(sws.database, userName, week)
+	if err != nil {
+		sws.handleErrorPage(w, req, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Private lines keep their marker instead of being displayed as a
+	// badge, as both versions may be copied into the editor.
+	w.WriteHeader(http.StatusConflict)
+	if err := sws.executeTemplate(w, req, "snippet_conflict.html", struct {
+		CurrentWeek   dates.IsoWeek
+		BodyThisWeek  []template.HTML
+		BodyNextWeek  []template.HTML
+		SavedThisWeek []template.HTML
+		SavedNextWeek []template.HTML
+		Version       int
+		Visibility    string
+	}{
+		CurrentWeek:   week,
+		BodyThisWeek:  markdown.RenderBody(bodyThisWeek, true),
+		BodyNextWeek:  markdown.RenderBody(bodyNextWeek, true),
+		SavedThisWeek: markdown.RenderBody(post.BodyThisWeek, post.IsMarkdown()),
+		SavedNextWeek: markdown.RenderBody(post.BodyNextWeek, post.IsMarkdown()),
+		Version:       version,
+		Visibility:    visibility,
+	}); err != nil {
+		log.Print(err)
 	}
-	return lines
 }
 
 func (sws *SnippetsWebService) handleSnippetView(w http.ResponseWriter, req *http.Request) {
@@ -188,14 +410,40 @@ func (sws *SnippetsWebService) handleSnippetView(w http.ResponseWriter, req *htt
 		return
 	}
 
-	template := ""
+	templateName := ""
 	realName := ""
 	subscribed := false
+	version := 0
+	visibility := post.Visibility
+	visible := true
+	var plans []string
 	currentUser := getCurrentUser(req)
 	if userName == currentUser {
-		template = "snippet_edit.html"
+		templateName = "snippet_edit.html"
+
+		// Obtain the version, which is submitted along with changes.
+		var err error
+		if version, err = getPostVersion(sws.database, userName, *week); err != nil {
+			sws.handleErrorPage(w, req, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if visibility == "" {
+			if visibility, err = getDefaultVisibility(sws.database, userName); err != nil {
+				sws.handleErrorPage(w, req, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		// Offer to import the plans of the previous week into a
+		// week for which nothing has been written yet.
+		if post.UserName == "" {
+			if plans, err = sws.getPendingPlans(userName, *week); err != nil {
+				sws.handleErrorPage(w, req, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
 	} else {
-		template = "snippet_view.html"
+		templateName = "snippet_view.html"
 
 		// Obtain real name.
 		var user schema.User
@@ -219,10 +467,45 @@ func (sws *SnippetsWebService) handleSnippetView(w http.ResponseWriter, req *htt
 			return
 		}
 		realName = user.RealName
+
+		// Hide snippets that may not be read by the current user, as
+		// if they have not been written.
+		if post.UserName != "" {
+			var err error
+			if visible, err = sws.canRead(currentUser, post); err != nil {
+				sws.handleErrorPage(w, req, err.Error(), http.StatusInternalServerError)
+				return
+			} else if !visible {
+				post = schema.Post{}
+			}
+		}
+		post = post.WithoutPrivateLinesFor(currentUser, user.Manager)
+	}
+
+	// The editor displays the marker of private lines, so that they
+	// remain private when the snippet is saved again.
+	renderBody := markdown.RenderPostBody
+	if templateName == "snippet_edit.html" {
+		renderBody = markdown.RenderBody
+	}
+
+	// Obtain comments.
+	canComment := false
+	var comments []*commentNode
+	if visible {
+		var err error
+		if canComment, err = sws.canComment(currentUser, userName); err != nil {
+			sws.handleErrorPage(w, req, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if comments, err = sws.getComments(userName, *week, canComment); err != nil {
+			sws.handleErrorPage(w, req, err.Error(), http.StatusInternalServerError)
+			return
+		}
 	}
 
 	lastWeek := dates.LastIsoWeek()
-	if err := sws.templates.ExecuteTemplate(w, template, struct {
+	if err := sws.executeTemplate(w, req, templateName, struct {
 		RealName            string
 		PreviousWeek        *dates.IsoWeek
 		CurrentWeek         dates.IsoWeek
@@ -230,9 +513,14 @@ func (sws *SnippetsWebService) handleSnippetView(w http.ResponseWriter, req *htt
 		CurrentWeekLastDay  string
 		NextWeek            *dates.IsoWeek
 		LastWeek            dates.IsoWeek
-		BodyThisWeek        []string
-		BodyNextWeek        []string
+		BodyThisWeek        []template.HTML
+		BodyNextWeek        []template.HTML
+		Version             int
+		Visibility          string
+		Plans               []template.HTML
 		Subscribed          bool
+		Comments            []*commentNode
+		CanComment          bool
 	}{
 		RealName:            realName,
 		PreviousWeek:        week.Seek(-1),
@@ -241,9 +529,14 @@ func (sws *SnippetsWebService) handleSnippetView(w http.ResponseWriter, req *htt
 		CurrentWeekLastDay:  week.LastDay(),
 		NextWeek:            week.Seek(1),
 		LastWeek:            lastWeek,
-		BodyThisWeek:        splitLines(post.BodyThisWeek),
-		BodyNextWeek:        splitLines(post.BodyNextWeek),
+		BodyThisWeek:        renderBody(post.BodyThisWeek, post.IsMarkdown()),
+		BodyNextWeek:        renderBody(post.BodyNextWeek, post.IsMarkdown()),
+		Version:             version,
+		Visibility:          visibility,
+		Plans:               markdown.RenderPostBody(strings.Join(plans, "\n"), true),
 		Subscribed:          subscribed,
+		Comments:            comments,
+		CanComment:          canComment,
 	}); err != nil {
 		log.Print(err)
 	}
@@ -270,7 +563,7 @@ func (sws *SnippetsWebService) handleSubscribe(w http.ResponseWriter, req *http.
 		return
 	}
 
-	http.Redirect(w, req, req.Referer(), http.StatusSeeOther)
+	http.Redirect(w, req, sws.getReturnUrl(req.FormValue("return_to"), fmt.Sprintf("/%s/%s", userName, *dates.LastIsoWeek().Seek(-1))), http.StatusSeeOther)
 }
 
 func (sws *SnippetsWebService) handleUnsubscribe(w http.ResponseWriter, req *http.Request) {
@@ -286,5 +579,5 @@ func (sws *SnippetsWebService) handleUnsubscribe(w http.ResponseWriter, req *htt
 		return
 	}
 
-	http.Redirect(w, req, req.Referer(), http.StatusSeeOther)
+	http.Redirect(w, req, sws.getReturnUrl(req.FormValue("return_to"), fmt.Sprintf("/%s/%s", userName, *dates.LastIsoWeek().Seek(-1))), http.StatusSeeOther)
 }
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/ProdriveTechnologies/snippets/pkg/dates"
+	"github.com/ProdriveTechnologies/snippets/pkg/markdown"
+	"github.com/ProdriveTechnologies/snippets/pkg/schema"
+	"github.com/gorilla/mux"
+	"github.com/jinzhu/gorm"
+)
+
+var validTeamName = regexp.MustCompile("^[a-z0-9-]+$")
+
+// registerTeamRoutes adds the pages for managing teams and viewing the
+// snippets of their members to the router.
+func (sws *SnippetsWebService) registerTeamRoutes(router *mux.Router) {
+	router.HandleFunc("/teams", sws.handleTeamList)
+	router.HandleFunc("/team/{team_name:[a-z0-9-]+}", sws.handleTeamLandingPage)
+	router.HandleFunc("/team/{team_name:[a-z0-9-]+}/{year:[0-9]{4}}-W{week:[0-9]{2}}", sws.handleTeamView)
+	router.HandleFunc("/team/{team_name:[a-z0-9-]+}/members", sws.handleTeamMemberAdd)
+	router.HandleFunc("/team/{team_name:[a-z0-9-]+}/members/{user_name:[a-z]+}/remove", sws.handleTeamMemberRemove)
+	router.HandleFunc("/team/{team_name:[a-z0-9-]+}/subscribe", sws.handleTeamSubscribe)
+	router.HandleFunc("/team/{team_name:[a-z0-9-]+}/unsubscribe", sws.handleTeamUnsubscribe)
+}
+
+// snippet of a single user, as displayed on pages showing the snippets
+// of multiple users at once.
+type snippet struct {
+	UserName     string
+	RealName     string
+	BodyThisWeek []template.HTML
+	BodyNextWeek []template.HTML
+}
+
+// getSnippets returns the snippets that a list of users have written
+// in a given week, in the same order as the users. Users who have not
+// written a snippet, or whose snippet may not be read by the current
+// user, are returned separately.
+func (sws *SnippetsWebService) getSnippets(users []schema.User, week dates.IsoWeek, currentUser string) ([]snippet, []schema.User, error) {
+	var userNames []string
+	for _, user := range users {
+		userNames = append(userNames, user.UserName)
+	}
+	db, err := sws.whereVisible(sws.database, currentUser)
+	if err != nil {
+		return nil, nil, err
+	}
+	var posts []schema.Post
+	if r := db.Where("user_name IN (?) AND year = ? AND week = ?", userNames, week.Year, week.Week).Find(&posts); r.Error != nil {
+		return nil, nil, r.Error
+	}
+	postsMap := map[string]schema.Post{}
+	for _, post := range posts {
+		postsMap[post.UserName] = post
+	}
+
+	var snippets []snippet
+	var didNotWriteSnippets []schema.User
+	for _, user := range users {
+		if post, ok := postsMap[user.UserName]; ok {
+			post = post.WithoutPrivateLinesFor(currentUser, user.Manager)
+			snippets = append(snippets, snippet{
+				UserName:     user.UserName,
+				RealName:     user.RealName,
+				BodyThisWeek: markdown.RenderPostBody(post.BodyThisWeek, post.IsMarkdown()),
+				BodyNextWeek: markdown.RenderPostBody(post.BodyNextWeek, post.IsMarkdown()),
+			})
+		} else {
+			didNotWriteSnippets = append(didNotWriteSnippets, user)
+		}
+	}
+	return snippets, didNotWriteSnippets, nil
+}
+
+// getTeam obtains a team and its members, sorted by real name.
+func (sws *SnippetsWebService) getTeam(w http.ResponseWriter, req *http.Request) (*schema.Team, []schema.User) {
+	var team schema.Team
+	if r := sws.database.Where("name = ?", mux.Vars(req)["team_name"]).Take(&team); r.Error != nil {
+		if gorm.IsRecordNotFoundError(r.Error) {
+			http.NotFound(w, req)
+		} else {
+			sws.handleErrorPage(w, req, r.Error.Error(), http.StatusInternalServerError)
+		}
+		return nil, nil
+	}
+
+	var teamMembers []schema.TeamMember
+	if r := sws.database.Where("team_name = ?", team.Name).Find(&teamMembers); r.Error != nil {
+		sws.handleErrorPage(w, req, r.Error.Error(), http.StatusInternalServerError)
+		return nil, nil
+	}
+	var userNames []string
+	for _, teamMember := range teamMembers {
+		userNames = append(userNames, teamMember.UserName)
+	}
+	var members []schema.User
+	if r := sws.database.Where("user_name IN (?)", userNames).Order("real_name").Find(&members); r.Error != nil {
+		sws.handleErrorPage(w, req, r.Error.Error(), http.StatusInternalServerError)
+		return nil, nil
+	}
+	return &team, members
+}
+
+func isTeamMember(members []schema.User, userName string) bool {
+	for _, member := range members {
+		if member.UserName == userName {
+			return true
+		}
+	}
+	return false
+}
+
+func (sws *SnippetsWebService) handleTeamList(w http.ResponseWriter, req *http.Request) {
+	if req.Method == "POST" {
+		sws.handleTeamCreate(w, req)
+		return
+	}
+
+	var teams []schema.Team
+	if r := sws.database.Order("name").Find(&teams); r.Error != nil {
+		sws.handleErrorPage(w, req, r.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := sws.executeTemplate(w, req, "team_list.html", struct {
+		Teams    []schema.Team
+		LastWeek dates.IsoWeek
+	}{
+		Teams:    teams,
+		LastWeek: *dates.LastIsoWeek().Seek(-1),
+	}); err != nil {
+		log.Print(err)
+	}
+}
+
+func (sws *SnippetsWebService) handleTeamCreate(w http.ResponseWriter, req *http.Request) {
+	req.ParseForm()
+	team := schema.Team{
+		Name:        strings.TrimSpace(req.Form.Get("name")),
+		Description: strings.TrimSpace(req.Form.Get("description")),
+	}
+	if !validTeamName.MatchString(team.Name) {
+		sws.handleErrorPage(w, req, "Team names may only consist of lowercase letters, digits and dashes", http.StatusBadRequest)
+		return
+	}
+
+	if err := sws.createOrUpdateUser(req); err != nil {
+		sws.handleErrorPage(w, req, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var existing schema.Team
+	if r := sws.database.Where("name = ?", team.Name).Take(&existing); r.Error == nil {
+		sws.handleErrorPage(w, req, "A team with this name already exists", http.StatusConflict)
+		return
+	} else if !gorm.IsRecordNotFoundError(r.Error) {
+		sws.handleErrorPage(w, req, r.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// The creator of a team automatically becomes its first member.
+	tx := sws.database.Begin()
+	if r := tx.Create(&team); r.Error != nil {
+		tx.Rollback()
+		sws.handleErrorPage(w, req, r.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+	if r := tx.Create(&schema.TeamMember{TeamName: team.Name, UserName: getCurrentUser(req)}); r.Error != nil {
+		tx.Rollback()
+		sws.handleErrorPage(w, req, r.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+	if r := tx.Commit(); r.Error != nil {
+		sws.handleErrorPage(w, req, r.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, req, fmt.Sprintf("%steam/%s", sws.selfUrl, team.Name), http.StatusSeeOther)
+}
+
+func (sws *SnippetsWebService) handleTeamLandingPage(w http.ResponseWriter, req *http.Request) {
+	http.Redirect(w, req, fmt.Sprintf("%steam/%s/%s", sws.selfUrl, mux.Vars(req)["team_name"], *dates.LastIsoWeek().Seek(-1)), http.StatusSeeOther)
+}
+
+func (sws *SnippetsWebService) handleTeamView(w http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	week := dates.ParseIsoWeek(vars["year"], vars["week"])
+	if week == nil {
+		http.NotFound(w, req)
+		return
+	}
+
+	team, members := sws.getTeam(w, req)
+	if team == nil {
+		return
+	}
+	snippets, didNotWriteSnippets, err := sws.getSnippets(members, *week, getCurrentUser(req))
+	if err != nil {
+		sws.handleErrorPage(w, req, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	currentUser := getCurrentUser(req)
+	subscribed := false
+	var subscription schema.TeamSubscription
+	if r := sws.database.Where("subscriber = ? AND team_name = ?", currentUser, team.Name).Take(&subscription); r.Error == nil {
+		subscribed = true
+	} else if !gorm.IsRecordNotFoundError(r.Error) {
+		sws.handleErrorPage(w, req, r.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := sws.executeTemplate(w, req, "team_view.html", struct {
+		Team                schema.Team
+		Members             []schema.User
+		CurrentUser         string
+		IsMember            bool
+		Subscribed          bool
+		PreviousWeek        *dates.IsoWeek
+		CurrentWeek         dates.IsoWeek
+		CurrentWeekFirstDay string
+		CurrentWeekLastDay  string
+		NextWeek            *dates.IsoWeek
+		LastWeek            dates.IsoWeek
+		Snippets            []snippet
+		DidNotWriteSnippets []schema.User
+	}{
+		Team:                *team,
+		Members:             members,
+		CurrentUser:         currentUser,
+		IsMember:            isTeamMember(members, currentUser),
+		Subscribed:          subscribed,
+		PreviousWeek:        week.Seek(-1),
+		CurrentWeek:         *week,
+		CurrentWeekFirstDay: week.FirstDay(),
+		CurrentWeekLastDay:  week.LastDay(),
+		NextWeek:            week.Seek(1),
+		LastWeek:            dates.LastIsoWeek(),
+		Snippets:            snippets,
+		DidNotWriteSnippets: didNotWriteSnippets,
+	}); err != nil {
+		log.Print(err)
+	}
+}
+
+// handleTeamMemberAdd adds a user to a team. Users may always join a
+// team themselves. Existing members may add other users.
+func (sws *SnippetsWebService) handleTeamMemberAdd(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		sws.handleErrorPage(w, req, "Expected POST request", http.StatusMethodNotAllowed)
+		return
+	}
+
+	team, members := sws.getTeam(w, req)
+	if team == nil {
+		return
+	}
+	currentUser := getCurrentUser(req)
+	userName := req.FormValue("user_name")
+	if userName == "" {
+		userName = currentUser
+	}
+	if userName != currentUser && !isTeamMember(members, currentUser) {
+		sws.handleErrorPage(w, req, "Only members of a team can add other users to it", http.StatusForbidden)
+		return
+	}
+
+	if err := sws.createOrUpdateUser(req); err != nil {
+		sws.handleErrorPage(w, req, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var user schema.User
+	if r := sws.database.Where("user_name = ?", userName).Take(&user); r.Error != nil {
+		if gorm.IsRecordNotFoundError(r.Error) {
+			sws.handleErrorPage(w, req, "User not found", http.StatusBadRequest)
+		} else {
+			sws.handleErrorPage(w, req, r.Error.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	if r := sws.database.FirstOrCreate(&schema.TeamMember{
+		TeamName: team.Name,
+		UserName: userName,
+	}); r.Error != nil {
+		sws.handleErrorPage(w, req, r.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, req, sws.getReturnUrl(req.FormValue("return_to"), "/team/"+team.Name), http.StatusSeeOther)
+}
+
+// handleTeamMemberRemove removes a user from a team. This can be done
+// by the user itself, or by any of the other members.
+func (sws *SnippetsWebService) handleTeamMemberRemove(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		sws.handleErrorPage(w, req, "Expected POST request", http.StatusMethodNotAllowed)
+		return
+	}
+
+	team, members := sws.getTeam(w, req)
+	if team == nil {
+		return
+	}
+	if !isTeamMember(members, getCurrentUser(req)) {
+		sws.handleErrorPage(w, req, "Only members of a team can remove users from it", http.StatusForbidden)
+		return
+	}
+
+	if r := sws.database.Where("team_name = ? AND user_name = ?", team.Name, mux.Vars(req)["user_name"]).Delete(&schema.TeamMember{}); r.Error != nil {
+		sws.handleErrorPage(w, req, r.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, req, sws.getReturnUrl(req.FormValue("return_to"), "/team/"+team.Name), http.StatusSeeOther)
+}
+
+func (sws *SnippetsWebService) handleTeamSubscribe(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		sws.handleErrorPage(w, req, "Expected POST request", http.StatusMethodNotAllowed)
+		return
+	}
+
+	team, _ := sws.getTeam(w, req)
+	if team == nil {
+		return
+	}
+	if err := sws.createOrUpdateUser(req); err != nil {
+		sws.handleErrorPage(w, req, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if r := sws.database.FirstOrCreate(&schema.TeamSubscription{
+		Subscriber: getCurrentUser(req),
+		TeamName:   team.Name,
+	}); r.Error != nil {
+		sws.handleErrorPage(w, req, r.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, req, sws.getReturnUrl(req.FormValue("return_to"), "/team/"+team.Name), http.StatusSeeOther)
+}
+
+func (sws *SnippetsWebService) handleTeamUnsubscribe(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		sws.handleErrorPage(w, req, "Expected POST request", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if r := sws.database.Where("subscriber = ? AND team_name = ?", getCurrentUser(req), mux.Vars(req)["team_name"]).Delete(&schema.TeamSubscription{}); r.Error != nil {
+		sws.handleErrorPage(w, req, r.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, req, sws.getReturnUrl(req.FormValue("return_to"), "/team/"+mux.Vars(req)["team_name"]), http.StatusSeeOther)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/ProdriveTechnologies/snippets/pkg/schema"
+	"github.com/gorilla/mux"
+	"github.com/jinzhu/gorm"
+)
+
+// registerUnsubscribeRoutes adds the pages to which the unsubscribe
+// links in subscriptions emails point. As recipients may not be logged
+// in, and mail clients cannot authenticate through the authenticating
+// proxy, links are authenticated using a signature that is part of the
+// URL.
+func (sws *SnippetsWebService) registerUnsubscribeRoutes(router *mux.Router) {
+	router.HandleFunc("/unsubscribe/{subscriber:[a-z]+}", sws.handleEmailUnsubscribe)
+	router.HandleFunc("/unsubscribe/{subscriber:[a-z]+}/{subscribee:[a-z]+}", sws.handleEmailUnsubscribe)
+}
+
+// handleEmailUnsubscribe unsubscribes the recipient of a subscriptions
+// email from a single user, or from everyone including teams. GET
+// requests ask for confirmation, as mail scanners may follow links. POST
+// requests unsubscribe right away, as sent by mail clients that support
+// one-click unsubscription.
+func (sws *SnippetsWebService) handleEmailUnsubscribe(w http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	subscriber, subscribee := vars["subscriber"], vars["subscribee"]
+	signature := req.FormValue("signature")
+	if sws.unsubscribeLinks == nil || !sws.unsubscribeLinks.Verify(subscriber, subscribee, signature) {
+		sws.handleErrorPage(w, req, "This unsubscribe link is invalid. Please unsubscribe through the pages of the people you are subscribed to instead.", http.StatusForbidden)
+		return
+	}
+
+	var subscribeeUser schema.User
+	if subscribee != "" {
+		if r := sws.database.Where("user_name = ?", subscribee).Take(&subscribeeUser); r.Error != nil && !gorm.IsRecordNotFoundError(r.Error) {
+			sws.handleErrorPage(w, req, r.Error.Error(), http.StatusInternalServerError)
+			return
+		}
+		subscribeeUser.UserName = subscribee
+	}
+
+	unsubscribed := false
+	if req.Method == "POST" {
+		if err := sws.unsubscribeFromEmails(subscriber, subscribee); err != nil {
+			sws.handleErrorPage(w, req, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		unsubscribed = true
+	}
+
+	if err := sws.executeTemplate(w, req, "unsubscribe.html", struct {
+		Subscribee   schema.User
+		Signature    string
+		Unsubscribed bool
+	}{
+		Subscribee:   subscribeeUser,
+		Signature:    signature,
+		Unsubscribed: unsubscribed,
+	}); err != nil {
+		log.Print(err)
+	}
+}
+
+// unsubscribeFromEmails removes the subscription of a subscriber to a
+// subscribee. If the subscribee is empty, all subscriptions to users
+// and teams are removed.
+func (sws *SnippetsWebService) unsubscribeFromEmails(subscriber string, subscribee string) error {
+	if subscribee != "" {
+		return sws.database.Where("subscriber = ? AND subscribee = ?", subscriber, subscribee).Delete(&schema.Subscription{}).Error
+	}
+
+	tx := sws.database.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if r := tx.Where("subscriber = ?", subscriber).Delete(&schema.Subscription{}); r.Error != nil {
+		tx.Rollback()
+		return r.Error
+	}
+	if r := tx.Where("subscriber = ?", subscriber).Delete(&schema.TeamSubscription{}); r.Error != nil {
+		tx.Rollback()
+		return r.Error
+	}
+	return tx.Commit().Error
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"github.com/ProdriveTechnologies/snippets/pkg/schema"
+	"github.com/jinzhu/gorm"
+)
+
+// getRelatedUsers returns the users whose posts that are only visible
+// to subscribers may be read by a user. These are the users the user
+// is subscribed to, either directly or through a team. Sharing a team
+// grants no access, as users may join any team without approval.
+func (sws *SnippetsWebService) getRelatedUsers(userName string) (map[string]bool, error) {
+	related := map[string]bool{}
+	subscribees, err := sws.getSubscribees(userName)
+	if err != nil {
+		return nil, err
+	}
+	for _, subscribee := range subscribees {
+		related[subscribee.UserName] = true
+	}
+	return related, nil
+}
+
+// whereVisible restricts a query on posts to the ones that may be read
+// by a user.
+func (sws *SnippetsWebService) whereVisible(db *gorm.DB, userName string) (*gorm.DB, error) {
+	related, err := sws.getRelatedUsers(userName)
+	if err != nil {
+		return nil, err
+	}
+	var relatedList []string
+	for relatedUser := range related {
+		relatedList = append(relatedList, relatedUser)
+	}
+	return db.Where(
+		"user_name = ? OR visibility = ? OR (visibility = ? AND user_name IN (?))",
+		userName, schema.VisibilityPublic, schema.VisibilitySubscribers, relatedList), nil
+}
+
+// canRead returns whether a post may be read by a user.
+func (sws *SnippetsWebService) canRead(userName string, post schema.Post) (bool, error) {
+	if post.IsVisibleTo(userName, false) {
+		return true, nil
+	}
+	if post.Visibility != schema.VisibilitySubscribers {
+		return false, nil
+	}
+	related, err := sws.getRelatedUsers(userName)
+	if err != nil {
+		return false, err
+	}
+	return related[post.UserName], nil
+}
+
+// getDefaultVisibility returns the visibility of posts that a user
+// creates.
+func getDefaultVisibility(db *gorm.DB, userName string) (string, error) {
+	var user schema.User
+	if r := db.Where("user_name = ?", userName).Take(&user); r.Error != nil {
+		if gorm.IsRecordNotFoundError(r.Error) {
+			return schema.VisibilityPublic, nil
+		}
+		return "", r.Error
+	}
+	if !schema.IsValidVisibility(user.DefaultVisibility) {
+		return schema.VisibilityPublic, nil
+	}
+	return user.DefaultVisibility, nil
+}
+
+// getManagers returns the managers of a list of users, indexed by the
+// names of the users.
+func getManagers(db *gorm.DB, userNames []string) (map[string]string, error) {
+	var users []schema.User
+	if r := db.Where("user_name IN (?)", userNames).Find(&users); r.Error != nil {
+		return nil, r.Error
+	}
+	managers := map[string]string{}
+	for _, user := range users {
+		managers[user.UserName] = user.Manager
+	}
+	return managers, nil
+}
+
+// withoutPrivateLines removes the private lines from posts that may not
+// be read in full by a user.
+func (sws *SnippetsWebService) withoutPrivateLines(posts []schema.Post, userName string) ([]schema.Post, error) {
+	var authors []string
+	for _, post := range posts {
+		authors = append(authors, post.UserName)
+	}
+	managers, err := getManagers(sws.database, authors)
+	if err != nil {
+		return nil, err
+	}
+	filtered := make([]schema.Post, 0, len(posts))
+	for _, post := range posts {
+		filtered = append(filtered, post.WithoutPrivateLinesFor(userName, managers[post.UserName]))
+	}
+	return filtered, nil
+}
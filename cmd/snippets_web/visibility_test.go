@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/ProdriveTechnologies/snippets/pkg/schema"
+)
+
+// TestCanReadWithoutSubscriptions covers the cases in which canRead
+// does not need to look up the subscriptions of the user.
+func TestCanReadWithoutSubscriptions(t *testing.T) {
+	sws := &SnippetsWebService{}
+	for _, test := range []struct {
+		visibility string
+		userName   string
+		expected   bool
+	}{
+		{schema.VisibilityPublic, "bob", true},
+		{schema.VisibilitySubscribers, "alice", true},
+		{schema.VisibilityPrivate, "alice", true},
+		{schema.VisibilityPrivate, "bob", false},
+	} {
+		post := schema.Post{UserName: "alice", Visibility: test.visibility}
+		canRead, err := sws.canRead(test.userName, post)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if canRead != test.expected {
+			t.Errorf("Post with visibility %#v read by %#v: expected %v, got %v", test.visibility, test.userName, test.expected, canRead)
+		}
+	}
+}
@@ -2,8 +2,14 @@ CREATE TABLE users (
 	user_name STRING NOT NULL,
 	real_name STRING NOT NULL,
 	email_address STRING NOT NULL,
+	default_visibility STRING NOT NULL DEFAULT 'public',
+	manager STRING NOT NULL DEFAULT '',
+	chat_webhook_url STRING NOT NULL DEFAULT '',
+	chat_reminders BOOL NOT NULL DEFAULT false,
+	chat_subscriptions BOOL NOT NULL DEFAULT false,
 	CONSTRAINT "primary" PRIMARY KEY (user_name ASC),
-	FAMILY "primary" (user_name, real_name, email_address)
+	FAMILY "primary" (user_name, real_name, email_address, default_visibility, manager, chat_webhook_url, chat_reminders, chat_subscriptions),
+	CONSTRAINT check_default_visibility CHECK (default_visibility IN ('public', 'subscribers', 'private'))
 );
 
 CREATE TABLE posts (
@@ -12,12 +18,70 @@ CREATE TABLE posts (
 	week INT NOT NULL,
 	body_this_week STRING NOT NULL,
 	body_next_week STRING NOT NULL,
+	format STRING NOT NULL DEFAULT '',
+	visibility STRING NOT NULL DEFAULT 'public',
 	CONSTRAINT "primary" PRIMARY KEY (user_name ASC, year ASC, week ASC),
 	INDEX posts_user_name_idx (user_name ASC),
 	CONSTRAINT fk_user_name_ref_users FOREIGN KEY (user_name) REFERENCES users (user_name),
-	FAMILY "primary" (user_name, year, week, body_this_week, body_next_week),
+	FAMILY "primary" (user_name, year, week, body_this_week, body_next_week, format, visibility),
 	CONSTRAINT check_week_week CHECK ((week >= 1) AND (week <= 53)),
-	CONSTRAINT check_body_this_week_body_next_week CHECK ((body_this_week != '') OR (body_next_week != ''))
+	CONSTRAINT check_body_this_week_body_next_week CHECK ((body_this_week != '') OR (body_next_week != '')),
+	CONSTRAINT check_visibility CHECK (visibility IN ('public', 'subscribers', 'private'))
+);
+
+CREATE TABLE post_revisions (
+	user_name STRING NOT NULL,
+	year INT NOT NULL,
+	week INT NOT NULL,
+	revision INT NOT NULL,
+	author STRING NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL,
+	body_this_week STRING NOT NULL,
+	body_next_week STRING NOT NULL,
+	format STRING NOT NULL,
+	CONSTRAINT "primary" PRIMARY KEY (user_name ASC, year ASC, week ASC, revision ASC),
+	CONSTRAINT fk_user_name_ref_users FOREIGN KEY (user_name) REFERENCES users (user_name),
+	CONSTRAINT fk_author_ref_users FOREIGN KEY (author) REFERENCES users (user_name),
+	INDEX post_revisions_author_idx (author ASC),
+	FAMILY "primary" (user_name, year, week, revision, author, created_at, body_this_week, body_next_week, format),
+	CONSTRAINT check_week_week CHECK ((week >= 1) AND (week <= 53)),
+	CONSTRAINT check_revision_revision CHECK (revision >= 1)
+);
+
+CREATE TABLE plan_outcomes (
+	user_name STRING NOT NULL,
+	year INT NOT NULL,
+	week INT NOT NULL,
+	position INT NOT NULL,
+	plan STRING NOT NULL,
+	outcome STRING NOT NULL,
+	carried_weeks INT NOT NULL DEFAULT 0,
+	CONSTRAINT "primary" PRIMARY KEY (user_name ASC, year ASC, week ASC, position ASC),
+	CONSTRAINT fk_user_name_ref_users FOREIGN KEY (user_name) REFERENCES users (user_name),
+	FAMILY "primary" (user_name, year, week, position, plan, outcome, carried_weeks),
+	CONSTRAINT check_week_week CHECK ((week >= 1) AND (week <= 53)),
+	CONSTRAINT check_outcome CHECK (outcome IN ('done', 'carried_over', 'dropped'))
+);
+
+CREATE TABLE comments (
+	id SERIAL NOT NULL,
+	user_name STRING NOT NULL,
+	year INT NOT NULL,
+	week INT NOT NULL,
+	author STRING NOT NULL,
+	parent_id INT NULL,
+	created_at TIMESTAMPTZ NOT NULL,
+	body STRING NOT NULL,
+	CONSTRAINT "primary" PRIMARY KEY (id ASC),
+	CONSTRAINT fk_user_name_ref_users FOREIGN KEY (user_name) REFERENCES users (user_name),
+	CONSTRAINT fk_author_ref_users FOREIGN KEY (author) REFERENCES users (user_name),
+	CONSTRAINT fk_parent_id_ref_comments FOREIGN KEY (parent_id) REFERENCES comments (id),
+	INDEX comments_user_name_year_week_idx (user_name ASC, year ASC, week ASC),
+	INDEX comments_author_idx (author ASC),
+	INDEX comments_parent_id_idx (parent_id ASC),
+	FAMILY "primary" (id, user_name, year, week, author, parent_id, created_at, body),
+	CONSTRAINT check_week_week CHECK ((week >= 1) AND (week <= 53)),
+	CONSTRAINT check_body CHECK (body != '')
 );
 
 CREATE TABLE subscriptions (
@@ -30,3 +94,88 @@ CREATE TABLE subscriptions (
 	FAMILY "primary" (subscriber, subscribee),
 	CONSTRAINT check_subscriber_subscribee CHECK (subscriber != subscribee)
 );
+
+CREATE TABLE feed_tokens (
+	user_name STRING NOT NULL,
+	token_hash STRING NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL,
+	CONSTRAINT "primary" PRIMARY KEY (user_name ASC),
+	CONSTRAINT fk_user_name_ref_users FOREIGN KEY (user_name) REFERENCES users (user_name),
+	UNIQUE INDEX feed_tokens_token_hash_key (token_hash ASC),
+	FAMILY "primary" (user_name, token_hash, created_at)
+);
+
+CREATE TABLE api_tokens (
+	id SERIAL NOT NULL,
+	user_name STRING NOT NULL,
+	description STRING NOT NULL,
+	token_hash STRING NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL,
+	last_used_at TIMESTAMPTZ NULL,
+	CONSTRAINT "primary" PRIMARY KEY (id ASC),
+	CONSTRAINT fk_user_name_ref_users FOREIGN KEY (user_name) REFERENCES users (user_name),
+	UNIQUE INDEX api_tokens_token_hash_key (token_hash ASC),
+	INDEX api_tokens_user_name_idx (user_name ASC),
+	FAMILY "primary" (id, user_name, description, token_hash, created_at, last_used_at)
+);
+
+CREATE TABLE deliveries (
+	recipient STRING NOT NULL,
+	kind STRING NOT NULL,
+	year INT NOT NULL,
+	week INT NOT NULL,
+	status STRING NOT NULL,
+	attempts INT NOT NULL DEFAULT 0,
+	message_id STRING NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL,
+	CONSTRAINT "primary" PRIMARY KEY (recipient ASC, kind ASC, year ASC, week ASC),
+	CONSTRAINT fk_recipient_ref_users FOREIGN KEY (recipient) REFERENCES users (user_name),
+	INDEX deliveries_message_id_idx (message_id ASC),
+	FAMILY "primary" (recipient, kind, year, week, status, attempts, message_id, updated_at),
+	CONSTRAINT check_week_week CHECK ((week >= 1) AND (week <= 53)),
+	CONSTRAINT check_kind CHECK (kind IN ('subscriptions', 'reminder')),
+	CONSTRAINT check_status CHECK (status IN ('sent', 'failed'))
+);
+
+CREATE TABLE outbound_emails (
+	id SERIAL NOT NULL,
+	recipient STRING NOT NULL,
+	message BYTES NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL,
+	status STRING NOT NULL,
+	attempts INT NOT NULL DEFAULT 0,
+	next_attempt_at TIMESTAMPTZ NOT NULL,
+	last_error STRING NOT NULL DEFAULT '',
+	message_id STRING NOT NULL DEFAULT '',
+	CONSTRAINT "primary" PRIMARY KEY (id ASC),
+	INDEX outbound_emails_status_next_attempt_at_idx (status ASC, next_attempt_at ASC),
+	FAMILY "primary" (id, recipient, message, created_at, status, attempts, next_attempt_at, last_error, message_id),
+	CONSTRAINT check_status CHECK (status IN ('pending', 'failed'))
+);
+
+CREATE TABLE teams (
+	name STRING NOT NULL,
+	description STRING NOT NULL,
+	CONSTRAINT "primary" PRIMARY KEY (name ASC),
+	FAMILY "primary" (name, description)
+);
+
+CREATE TABLE team_members (
+	team_name STRING NOT NULL,
+	user_name STRING NOT NULL,
+	CONSTRAINT "primary" PRIMARY KEY (team_name ASC, user_name ASC),
+	CONSTRAINT fk_team_name_ref_teams FOREIGN KEY (team_name) REFERENCES teams (name),
+	CONSTRAINT fk_user_name_ref_users FOREIGN KEY (user_name) REFERENCES users (user_name),
+	INDEX team_members_user_name_idx (user_name ASC),
+	FAMILY "primary" (team_name, user_name)
+);
+
+CREATE TABLE team_subscriptions (
+	subscriber STRING NOT NULL,
+	team_name STRING NOT NULL,
+	CONSTRAINT "primary" PRIMARY KEY (subscriber ASC, team_name ASC),
+	CONSTRAINT fk_subscriber_ref_users FOREIGN KEY (subscriber) REFERENCES users (user_name),
+	CONSTRAINT fk_team_name_ref_teams FOREIGN KEY (team_name) REFERENCES teams (name),
+	INDEX team_subscriptions_team_name_idx (team_name ASC),
+	FAMILY "primary" (subscriber, team_name)
+);
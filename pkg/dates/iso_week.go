@@ -3,14 +3,15 @@ package dates
 import (
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/snabb/isoweek"
 )
 
 type IsoWeek struct {
-	Year int
-	Week int
+	Year int `json:"year"`
+	Week int `json:"week"`
 }
 
 func LastIsoWeek() IsoWeek {
@@ -69,3 +70,17 @@ func (iw IsoWeek) LastDay() string {
 	t := time.Date(year, month, day, 0, 0, 0, 0, time.UTC).Add(6 * 24 * time.Hour)
 	return fmt.Sprintf("%4d-%02d-%02d", t.Year(), t.Month(), t.Day())
 }
+
+// ParseIsoWeekString parses a week in the "2006-W01" notation that is
+// also emitted by IsoWeek.String().
+func ParseIsoWeekString(s string) *IsoWeek {
+	parts := strings.Split(s, "-W")
+	if len(parts) != 2 {
+		return nil
+	}
+	return ParseIsoWeek(parts[0], parts[1])
+}
+
+func (iw IsoWeek) Before(other IsoWeek) bool {
+	return iw.Year < other.Year || (iw.Year == other.Year && iw.Week < other.Week)
+}
@@ -0,0 +1,74 @@
+// Package diff computes line-based differences between two texts.
+package diff
+
+// Operation that needs to be applied to a line to get from the old text
+// to the new text.
+type Operation int
+
+const (
+	Equal Operation = iota
+	Insert
+	Delete
+)
+
+// Line of a difference between two texts.
+type Line struct {
+	Operation Operation
+	Text      string
+}
+
+// IsInsertion returns whether the line is only present in the new text.
+func (l Line) IsInsertion() bool {
+	return l.Operation == Insert
+}
+
+// IsDeletion returns whether the line is only present in the old text.
+func (l Line) IsDeletion() bool {
+	return l.Operation == Delete
+}
+
+// Lines computes a minimal difference between two lists of lines,
+// based on their longest common subsequence. Deletions are placed
+// before insertions when lines are replaced.
+func Lines(a []string, b []string) []Line {
+	// lcs[i][j] holds the length of the longest common subsequence
+	// of a[i:] and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var lines []Line
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		if a[i] == b[j] {
+			lines = append(lines, Line{Operation: Equal, Text: a[i]})
+			i++
+			j++
+		} else if lcs[i+1][j] >= lcs[i][j+1] {
+			lines = append(lines, Line{Operation: Delete, Text: a[i]})
+			i++
+		} else {
+			lines = append(lines, Line{Operation: Insert, Text: b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		lines = append(lines, Line{Operation: Delete, Text: a[i]})
+	}
+	for ; j < len(b); j++ {
+		lines = append(lines, Line{Operation: Insert, Text: b[j]})
+	}
+	return lines
+}
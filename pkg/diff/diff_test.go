@@ -0,0 +1,79 @@
+package diff
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLines(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		a        []string
+		b        []string
+		expected []Line
+	}{
+		{"BothEmpty", nil, nil, nil},
+		{
+			"OldEmpty", nil, []string{"a", "b"},
+			[]Line{{Insert, "a"}, {Insert, "b"}},
+		},
+		{
+			"NewEmpty", []string{"a", "b"}, nil,
+			[]Line{{Delete, "a"}, {Delete, "b"}},
+		},
+		{
+			"Unchanged", []string{"a", "b"}, []string{"a", "b"},
+			[]Line{{Equal, "a"}, {Equal, "b"}},
+		},
+		{
+			"Replaced", []string{"a", "b", "c"}, []string{"a", "x", "c"},
+			[]Line{{Equal, "a"}, {Delete, "b"}, {Insert, "x"}, {Equal, "c"}},
+		},
+		{
+			"ReplacedAll", []string{"a", "b"}, []string{"x", "y"},
+			[]Line{{Delete, "a"}, {Delete, "b"}, {Insert, "x"}, {Insert, "y"}},
+		},
+		{
+			"Appended", []string{"a"}, []string{"a", "b"},
+			[]Line{{Equal, "a"}, {Insert, "b"}},
+		},
+		{
+			"Prepended", []string{"b"}, []string{"a", "b"},
+			[]Line{{Insert, "a"}, {Equal, "b"}},
+		},
+		{
+			"Removed", []string{"a", "b", "c"}, []string{"a", "c"},
+			[]Line{{Equal, "a"}, {Delete, "b"}, {Equal, "c"}},
+		},
+		{
+			"Moved", []string{"a", "b", "c"}, []string{"b", "c", "a"},
+			[]Line{{Delete, "a"}, {Equal, "b"}, {Equal, "c"}, {Insert, "a"}},
+		},
+		{
+			"Duplicates", []string{"a", "a"}, []string{"a"},
+			[]Line{{Equal, "a"}, {Delete, "a"}},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if lines := Lines(test.a, test.b); !reflect.DeepEqual(lines, test.expected) {
+				t.Errorf("Expected %#v, got %#v", test.expected, lines)
+			}
+		})
+	}
+}
+
+func TestLineOperations(t *testing.T) {
+	for _, test := range []struct {
+		line      Line
+		insertion bool
+		deletion  bool
+	}{
+		{Line{Operation: Equal}, false, false},
+		{Line{Operation: Insert}, true, false},
+		{Line{Operation: Delete}, false, true},
+	} {
+		if test.line.IsInsertion() != test.insertion || test.line.IsDeletion() != test.deletion {
+			t.Errorf("Line %#v has incorrect operation predicates", test.line)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package emails
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ProdriveTechnologies/snippets/pkg/dates"
+	"github.com/ProdriveTechnologies/snippets/pkg/mail"
+	"github.com/ProdriveTechnologies/snippets/pkg/notify"
+	"github.com/jinzhu/gorm"
+)
+
+// CronFlags are the command line flags of the cron jobs that send
+// weekly emails, configuring how and to whom emails are delivered.
+type CronFlags struct {
+	sender           *mail.SenderFlags
+	worker           *mail.WorkerFlags
+	chatAllowedHosts *string
+	dryRun           *bool
+	dryRunDirectory  *string
+	previewUserName  *string
+	redirectTo       *string
+}
+
+// RegisterCronFlags registers the command line flags of a Cron.
+func RegisterCronFlags(flagSet *flag.FlagSet) *CronFlags {
+	return &CronFlags{
+		sender:           mail.RegisterSenderFlags(flagSet),
+		worker:           mail.RegisterWorkerFlags(flagSet),
+		chatAllowedHosts: flagSet.String("chat.allowed_hosts", "", "Comma-separated list of hosts to which users' chat webhooks may point. Delivery through chat is disabled if empty."),
+		dryRun:           flagSet.Bool("dry-run", false, "Instead of sending emails, write them to standard output or to -dry-run.directory."),
+		dryRunDirectory:  flagSet.String("dry-run.directory", "", "Directory in which to store emails as .eml files when -dry-run is set."),
+		previewUserName:  flagSet.String("preview.user_name", "", "Instead of sending emails, write the email that this user would receive to standard output."),
+		redirectTo:       flagSet.String("smtp.redirect_to", "", "Send all emails to this address instead of their recipients."),
+	}
+}
+
+// Source address of emails that are written instead of sent, if no
+// source address has been configured.
+const placeholderFrom = "snippets@localhost"
+
+// NewCron returns a Cron configured by the command line flags. An SMTP
+// server and source address are only required when emails are sent.
+func (cf *CronFlags) NewCron() (*Cron, error) {
+	sender, err := cf.sender.NewSender()
+	if err != nil {
+		return nil, err
+	}
+	if !*cf.dryRun && *cf.previewUserName == "" {
+		if sender.Smarthost == "" {
+			return nil, errors.New("The SMTP server must be provided using -smtp.smarthost, unless -dry-run is set")
+		}
+		if sender.From == "" {
+			return nil, errors.New("The source email address must be provided using -smtp.from")
+		}
+	}
+	return &Cron{
+		sender: sender,
+		flags:  cf,
+	}, nil
+}
+
+// Cron sends a batch of weekly emails, as done by the cron jobs.
+type Cron struct {
+	sender *mail.Sender
+	flags  *CronFlags
+}
+
+// from returns the source address of the emails.
+func (c *Cron) from() string {
+	if c.sender.From == "" {
+		return placeholderFrom
+	}
+	return c.sender.From
+}
+
+// newNotifier returns the notifier through which emails are delivered.
+// Emails are added to the outbound mail queue, so that they are retried
+// if they cannot be sent immediately.
+func (c *Cron) newNotifier(db *gorm.DB) notify.Notifier {
+	var transport mail.Transport = &mail.Queue{DB: db}
+	if *c.flags.dryRun {
+		if *c.flags.dryRunDirectory != "" {
+			transport = &mail.DirectoryWriter{Directory: *c.flags.dryRunDirectory}
+		} else {
+			transport = &mail.Printer{Writer: os.Stdout}
+		}
+	}
+	if *c.flags.redirectTo != "" {
+		transport = &mail.Redirector{Transport: transport, To: *c.flags.redirectTo}
+	}
+
+	// Users may prefer to receive emails through a chat webhook. When
+	// redirecting, all emails are sent to the redirect address instead.
+	notifier := &notify.PreferenceNotifier{
+		Email: &notify.EmailNotifier{Transport: transport},
+		Chat:  &notify.WebhookNotifier{Client: &http.Client{Timeout: 30 * time.Second}},
+	}
+	if *c.flags.chatAllowedHosts != "" && *c.flags.redirectTo == "" {
+		notifier.AllowedChatHosts = strings.Split(*c.flags.chatAllowedHosts, ",")
+	}
+	if *c.flags.dryRun {
+		notifier.Chat = &notify.Printer{Writer: os.Stdout}
+	}
+	return notifier
+}
+
+// preview writes the email that a single user would receive to
+// standard output.
+func (c *Cron) preview(batch Batch, userName string) error {
+	user, ok := batch.Recipient(userName)
+	if !ok {
+		return fmt.Errorf("User %#v receives no %s email for this week", userName, batch.Kind())
+	}
+	message, err := batch.Render(user.UserName, user.EmailAddress)
+	if err != nil {
+		return err
+	}
+	message.From = c.from()
+	body, err := message.Bytes()
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(body)
+	return err
+}
+
+// Run sends the emails of a batch for a given week, or previews one of
+// them if requested.
+func (c *Cron) Run(db *gorm.DB, batch Batch, week dates.IsoWeek, snippetsUrl string) error {
+	if *c.flags.previewUserName != "" {
+		return c.preview(batch, *c.flags.previewUserName)
+	}
+
+	// Deliveries are only recorded when emails are actually sent to
+	// their recipients, so that testing doesn't affect later runs.
+	var deliveryLog *DeliveryLog
+	if !*c.flags.dryRun && *c.flags.redirectTo == "" {
+		deliveryLog = NewDeliveryLog(db, batch.Kind(), week, snippetsUrl)
+	}
+	if err := Send(batch, c.from(), c.newNotifier(db), deliveryLog); err != nil {
+		return err
+	}
+
+	// Attempt to send the queued emails right away. Emails that fail
+	// are retried by snippets_web.
+	if *c.flags.dryRun {
+		return nil
+	}
+	return c.flags.worker.NewWorker(db, c.sender).ProcessDue()
+}
@@ -0,0 +1,69 @@
+package emails
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/ProdriveTechnologies/snippets/pkg/dates"
+	"github.com/ProdriveTechnologies/snippets/pkg/schema"
+	"github.com/jinzhu/gorm"
+)
+
+// DeliveryLog records which emails of a batch have been delivered, so
+// that a batch can be sent again after a failure without sending any
+// email twice.
+type DeliveryLog struct {
+	db     *gorm.DB
+	kind   string
+	week   dates.IsoWeek
+	domain string
+}
+
+// NewDeliveryLog returns the log of the emails of a given kind sent for
+// a week. The host name of the Snippets site is used to generate the
+// Message-ID headers of the emails.
+func NewDeliveryLog(db *gorm.DB, kind string, week dates.IsoWeek, snippetsUrl string) *DeliveryLog {
+	domain := "snippets"
+	if u, err := url.Parse(snippetsUrl); err == nil && u.Hostname() != "" {
+		domain = u.Hostname()
+	}
+	return &DeliveryLog{
+		db:     db,
+		kind:   kind,
+		week:   week,
+		domain: domain,
+	}
+}
+
+// get returns the delivery of the email to a recipient. Emails that
+// have not been sent yet yield a new delivery. The Message-ID is the
+// same for every attempt, so that mail clients can discard duplicates.
+func (dl *DeliveryLog) get(recipient string) (schema.Delivery, error) {
+	var delivery schema.Delivery
+	if r := dl.db.Where("recipient = ? AND kind = ? AND year = ? AND week = ?", recipient, dl.kind, dl.week.Year, dl.week.Week).Take(&delivery); r.Error != nil {
+		if !gorm.IsRecordNotFoundError(r.Error) {
+			return schema.Delivery{}, r.Error
+		}
+		delivery = schema.Delivery{
+			Recipient: recipient,
+			Kind:      dl.kind,
+			Year:      dl.week.Year,
+			Week:      dl.week.Week,
+			MessageID: fmt.Sprintf("<%s.%s.%s@%s>", dl.kind, dl.week, recipient, dl.domain),
+		}
+	}
+	return delivery, nil
+}
+
+// record the outcome of an attempt to deliver an email.
+func (dl *DeliveryLog) record(delivery schema.Delivery, sendErr error) error {
+	delivery.Attempts++
+	delivery.UpdatedAt = time.Now()
+	if sendErr == nil {
+		delivery.Status = schema.DeliveryStatusSent
+	} else {
+		delivery.Status = schema.DeliveryStatusFailed
+	}
+	return dl.db.Save(&delivery).Error
+}
@@ -0,0 +1,87 @@
+// Package emails renders the emails that are sent to users on a weekly
+// basis. Rendering is separated from sending, so that emails can also
+// be previewed without sending them.
+package emails
+
+import (
+	"log"
+	"sort"
+
+	"github.com/ProdriveTechnologies/snippets/pkg/mail"
+	"github.com/ProdriveTechnologies/snippets/pkg/notify"
+	"github.com/ProdriveTechnologies/snippets/pkg/schema"
+)
+
+// Batch of emails of the same kind, each sent to a different recipient.
+type Batch interface {
+	// Recipients returns the users that receive an email, sorted by
+	// user name.
+	Recipients() []schema.User
+	// Recipient returns a user that receives an email, if any.
+	Recipient(userName string) (schema.User, bool)
+	// Kind returns the kind of the emails, as recorded in the
+	// deliveries table.
+	Kind() string
+	// Render the email that is sent to a user, addressed to a given
+	// email address. The plain text alternative of the email is
+	// Markdown, so that it can also be delivered through chat.
+	Render(userName string, emailAddress string) (mail.Message, error)
+}
+
+func sortUsers(users []schema.User) {
+	sort.Slice(users, func(i int, j int) bool {
+		return users[i].UserName < users[j].UserName
+	})
+}
+
+// Send the emails of a batch from a given source address to all of its
+// recipients, through the channel chosen by the notifier. Failures to
+// send individual emails are logged. If a delivery log is provided,
+// emails that have already been delivered are skipped and the outcome
+// of every attempt is recorded.
+func Send(batch Batch, from string, notifier notify.Notifier, deliveryLog *DeliveryLog) error {
+	sent, skipped, failed := 0, 0, 0
+	for _, user := range batch.Recipients() {
+		var delivery schema.Delivery
+		if deliveryLog != nil {
+			var err error
+			if delivery, err = deliveryLog.get(user.UserName); err != nil {
+				return err
+			}
+			if delivery.Status == schema.DeliveryStatusSent {
+				skipped++
+				continue
+			}
+		}
+
+		message, err := batch.Render(user.UserName, user.EmailAddress)
+		if err != nil {
+			return err
+		}
+		message.From = from
+		message.MessageID = delivery.MessageID
+		messageBytes, err := message.Bytes()
+		if err != nil {
+			return err
+		}
+		sendErr := notifier.Notify(user, notify.Notification{
+			Kind:    batch.Kind(),
+			Message: messageBytes,
+			Text:    message.Text,
+		})
+		if sendErr == nil {
+			sent++
+		} else {
+			log.Print("Failed to notify ", user.UserName, ": ", sendErr)
+			failed++
+		}
+
+		if deliveryLog != nil {
+			if err := deliveryLog.record(delivery, sendErr); err != nil {
+				return err
+			}
+		}
+	}
+	log.Printf("Sent %d emails, skipped %d emails that were already delivered, failed to send %d emails", sent, skipped, failed)
+	return nil
+}
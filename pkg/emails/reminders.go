@@ -0,0 +1,209 @@
+package emails
+
+import (
+	"bytes"
+	"html/template"
+	netMail "net/mail"
+	"strings"
+	textTemplate "text/template"
+
+	"github.com/ProdriveTechnologies/snippets/pkg/dates"
+	"github.com/ProdriveTechnologies/snippets/pkg/mail"
+	"github.com/ProdriveTechnologies/snippets/pkg/markdown"
+	"github.com/ProdriveTechnologies/snippets/pkg/schema"
+	"github.com/jinzhu/gorm"
+)
+
+// ReminderBacklogWeeks is the number of weeks during which users need
+// to have written a snippet to receive reminders.
+const ReminderBacklogWeeks = 6
+
+// Reminders contains the data needed to render the emails that remind
+// users to write a snippet for a week.
+type Reminders struct {
+	SnippetsUrl  string
+	Week         dates.IsoWeek
+	BacklogWeeks int
+
+	users           map[string]schema.User
+	currentSnippets map[string]reminderSnippet
+}
+
+type reminderSnippet struct {
+	UserName     string
+	BodyThisWeek []template.HTML
+	BodyNextWeek []template.HTML
+}
+
+// LoadReminders queries the users that wrote a snippet during any of
+// the backlogWeeks weeks preceding a week, and the snippets they have
+// written for the week itself.
+func LoadReminders(db *gorm.DB, snippetsUrl string, week dates.IsoWeek, backlogWeeks int) (*Reminders, error) {
+	firstWeek := week
+	if seeked := week.Seek(-backlogWeeks); seeked != nil {
+		firstWeek = *seeked
+	}
+
+	// Query relevant data from the users table.
+	var users []schema.Post
+	if r := db.Select("user_name").Where("(year = ? and week >= ?) or year > ?", firstWeek.Year, firstWeek.Week, firstWeek.Year).Group("user_name").Find(&users); r.Error != nil {
+		return nil, r.Error
+	}
+
+	var usersList []string
+	for _, user := range users {
+		usersList = append(usersList, user.UserName)
+	}
+
+	var lastPosts []schema.Post
+	if r := db.Where("user_name in (?) and year = ? and week = ?", usersList, week.Year, week.Week).Find(&lastPosts); r.Error != nil {
+		return nil, r.Error
+	}
+
+	// Reminders are only sent to the authors of the posts, meaning
+	// private lines don't need to be removed.
+	currentSnippetsMap := map[string]reminderSnippet{}
+	for _, post := range lastPosts {
+		currentSnippetsMap[post.UserName] = reminderSnippet{
+			UserName:     post.UserName,
+			BodyThisWeek: markdown.RenderPostBody(post.BodyThisWeek, post.IsMarkdown()),
+			BodyNextWeek: markdown.RenderPostBody(post.BodyNextWeek, post.IsMarkdown()),
+		}
+	}
+
+	var usersInfo []schema.User
+	if r := db.Where("user_name in (?)", usersList).Order("user_name").Find(&usersInfo); r.Error != nil {
+		return nil, r.Error
+	}
+	usersMap := map[string]schema.User{}
+	for _, user := range usersInfo {
+		usersMap[user.UserName] = user
+	}
+
+	return &Reminders{
+		SnippetsUrl:     snippetsUrl,
+		Week:            week,
+		BacklogWeeks:    backlogWeeks,
+		users:           usersMap,
+		currentSnippets: currentSnippetsMap,
+	}, nil
+}
+
+// Recipients returns the users that are reminded, sorted by user name.
+func (r *Reminders) Recipients() []schema.User {
+	var recipients []schema.User
+	for _, user := range r.users {
+		recipients = append(recipients, user)
+	}
+	sortUsers(recipients)
+	return recipients
+}
+
+// Recipient returns a user if they are reminded.
+func (r *Reminders) Recipient(userName string) (schema.User, bool) {
+	user, ok := r.users[userName]
+	return user, ok
+}
+
+// Kind returns the kind of the emails, as recorded in the deliveries
+// table.
+func (r *Reminders) Kind() string {
+	return schema.DeliveryKindReminder
+}
+
+// Render the email that is sent to a user.
+func (r *Reminders) Render(userName string, emailAddress string) (mail.Message, error) {
+	user := r.users[userName]
+	body := bytes.NewBuffer([]byte{})
+	if err := remindersEmailBody.Execute(body, struct {
+		SnippetsUrl    string
+		UserName       string
+		RealName       string
+		BacklogWeeks   int
+		CurrentSnippet reminderSnippet
+	}{
+		SnippetsUrl:    r.SnippetsUrl,
+		UserName:       userName,
+		RealName:       user.RealName,
+		BacklogWeeks:   r.BacklogWeeks,
+		CurrentSnippet: r.currentSnippets[userName],
+	}); err != nil {
+		return mail.Message{}, err
+	}
+	text, err := r.RenderText(userName)
+	if err != nil {
+		return mail.Message{}, err
+	}
+	return mail.Message{
+		To:      netMail.Address{Name: user.RealName, Address: emailAddress},
+		Subject: "Snippets reminder",
+		Text:    text,
+		HTML:    body.String(),
+	}, nil
+}
+
+// RenderText renders the contents of the email that is sent to a user
+// as Markdown, for delivery through chat.
+func (r *Reminders) RenderText(userName string) (string, error) {
+	currentSnippet := r.currentSnippets[userName]
+	body := strings.Builder{}
+	if err := remindersText.Execute(&body, struct {
+		SnippetsUrl  string
+		UserName     string
+		Week         dates.IsoWeek
+		ItemsWritten int
+	}{
+		SnippetsUrl:  r.SnippetsUrl,
+		UserName:     userName,
+		Week:         r.Week,
+		ItemsWritten: len(currentSnippet.BodyThisWeek) + len(currentSnippet.BodyNextWeek),
+	}); err != nil {
+		return "", err
+	}
+	return body.String(), nil
+}
+
+var remindersText = textTemplate.Must(textTemplate.New("text").Parse(
+	`**Snippets reminder**
+{{if .ItemsWritten}}Your snippet for {{.Week}} currently contains {{.ItemsWritten}} items.{{else}}You haven't written a snippet for {{.Week}} yet.{{end}} It will be sent to your subscribers on Monday. Please make sure it is completed by then: {{.SnippetsUrl}}{{.UserName}}/{{.Week}}
+`))
+
+var remindersEmailBody = template.Must(template.New("email").Parse(
+	`<!DOCTYPE html>
+<html>
+	<head>
+		<title>Snippets</title>
+	</head>
+	<body>
+		<p>Hello {{.RealName}},</p>
+
+		<p>You are receiving this email, because you wrote on
+		<a href="{{.SnippetsUrl}}">Snippets</a> during any of the past
+		{{.BacklogWeeks}} weeks.</p>
+
+		{{if .CurrentSnippet.BodyThisWeek}}
+			<p>You currently wrote the following:</p>
+			<ul>
+				<li>What have you been up to this week?</li>
+				<ul>
+					{{range .CurrentSnippet.BodyThisWeek}}
+						<li>{{.}}</li>
+					{{end}}
+				</ul>
+				{{if .CurrentSnippet.BodyNextWeek}}
+					<li>What are your plans for next week?</li>
+					<ul>
+						{{range .CurrentSnippet.BodyNextWeek}}
+							<li>{{.}}</li>
+						{{end}}
+					</ul>
+				{{end}}
+			</ul>
+		{{else}}
+			<p>You currently didn't write any snippets this week.</p>
+		{{end}}
+
+		<p>Your snippet will be sent on Monday to your subscribers.
+		Please make sure they are completed by then.</p>
+	</body>
+</html>`))
@@ -0,0 +1,372 @@
+package emails
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	netMail "net/mail"
+	"sort"
+	"strings"
+	textTemplate "text/template"
+
+	"github.com/ProdriveTechnologies/snippets/pkg/dates"
+	"github.com/ProdriveTechnologies/snippets/pkg/mail"
+	"github.com/ProdriveTechnologies/snippets/pkg/markdown"
+	"github.com/ProdriveTechnologies/snippets/pkg/schema"
+	"github.com/jinzhu/gorm"
+)
+
+// Subscriptions contains the data needed to render the emails that
+// send copies of the snippets written in a week to subscribers.
+type Subscriptions struct {
+	SnippetsUrl string
+	Week        dates.IsoWeek
+	// Links through which recipients can unsubscribe. Emails contain
+	// no such links if nil.
+	Unsubscribe *UnsubscribeLinks
+
+	users                map[string]schema.User
+	usersWithSubscribees map[string][]string
+	directSubscriptions  map[schema.Subscription]bool
+	posts                map[string]schema.Post
+}
+
+// LoadSubscriptions queries the subscriptions of all users and the
+// snippets written in a week.
+func LoadSubscriptions(db *gorm.DB, snippetsUrl string, week dates.IsoWeek) (*Subscriptions, error) {
+	return loadSubscriptions(db, db, db, snippetsUrl, week)
+}
+
+// LoadSubscriptionsOf queries the subscriptions of a single user and
+// the snippets written in a week, so that the email sent to the user
+// can be previewed without loading those of all other users.
+func LoadSubscriptionsOf(db *gorm.DB, snippetsUrl string, week dates.IsoWeek, subscriber string) (*Subscriptions, error) {
+	return loadSubscriptions(
+		db,
+		db.Where("subscriber = ?", subscriber),
+		db.Where("team_name IN (SELECT team_name FROM team_subscriptions WHERE subscriber = ?)", subscriber),
+		snippetsUrl,
+		week)
+}
+
+// loadSubscriptions queries the subscriptions and team memberships
+// selected by the provided queries and the snippets written in a week.
+func loadSubscriptions(db *gorm.DB, subscriptionsQuery *gorm.DB, teamMembersQuery *gorm.DB, snippetsUrl string, week dates.IsoWeek) (*Subscriptions, error) {
+	// Query relevant data from the subscriptions table.
+	var subscriptions []schema.Subscription
+	if r := subscriptionsQuery.Find(&subscriptions); r.Error != nil {
+		return nil, r.Error
+	}
+
+	// Subscriptions to individual users can be ended through a link
+	// in the email, unlike those that are implied by subscribing to a
+	// team.
+	directSubscriptions := map[schema.Subscription]bool{}
+	for _, subscription := range subscriptions {
+		directSubscriptions[subscription] = true
+	}
+
+	// Expand subscriptions to teams into subscriptions to all of their
+	// members.
+	var teamSubscriptions []schema.TeamSubscription
+	if r := subscriptionsQuery.Find(&teamSubscriptions); r.Error != nil {
+		return nil, r.Error
+	}
+	var teamMembers []schema.TeamMember
+	if r := teamMembersQuery.Find(&teamMembers); r.Error != nil {
+		return nil, r.Error
+	}
+	membersByTeam := map[string][]string{}
+	for _, teamMember := range teamMembers {
+		membersByTeam[teamMember.TeamName] = append(membersByTeam[teamMember.TeamName], teamMember.UserName)
+	}
+	for _, teamSubscription := range teamSubscriptions {
+		for _, member := range membersByTeam[teamSubscription.TeamName] {
+			if member != teamSubscription.Subscriber {
+				subscriptions = append(subscriptions, schema.Subscription{
+					Subscriber: teamSubscription.Subscriber,
+					Subscribee: member,
+				})
+			}
+		}
+	}
+
+	users := map[string]bool{}
+	usersWithSubscribers := map[string]bool{}
+	usersWithSubscribees := map[string][]string{}
+	seenSubscriptions := map[schema.Subscription]bool{}
+	for _, subscription := range subscriptions {
+		if seenSubscriptions[subscription] {
+			continue
+		}
+		seenSubscriptions[subscription] = true
+		users[subscription.Subscriber] = true
+		users[subscription.Subscribee] = true
+		usersWithSubscribers[subscription.Subscribee] = true
+		usersWithSubscribees[subscription.Subscriber] = append(usersWithSubscribees[subscription.Subscriber], subscription.Subscribee)
+	}
+	for _, subscribees := range usersWithSubscribees {
+		sort.Strings(subscribees)
+	}
+
+	// Query relevant data from the users table.
+	var usersList []string
+	for user, _ := range users {
+		usersList = append(usersList, user)
+	}
+	var usersData []schema.User
+	if r := db.Where("user_name IN (?)", usersList).Find(&usersData); r.Error != nil {
+		return nil, r.Error
+	}
+	usersMap := map[string]schema.User{}
+	for _, user := range usersData {
+		usersMap[user.UserName] = user
+	}
+
+	// Query relevant data from the posts table.
+	var usersWithSubscribersList []string
+	for user, _ := range usersWithSubscribers {
+		usersWithSubscribersList = append(usersWithSubscribersList, user)
+	}
+	var postsData []schema.Post
+	if r := db.Where("user_name IN (?) AND year = ?  AND week = ?", usersWithSubscribersList, week.Year, week.Week).Find(&postsData); r.Error != nil {
+		return nil, r.Error
+	}
+	postsMap := map[string]schema.Post{}
+	for _, post := range postsData {
+		postsMap[post.UserName] = post
+	}
+
+	return &Subscriptions{
+		SnippetsUrl:          snippetsUrl,
+		Week:                 week,
+		users:                usersMap,
+		usersWithSubscribees: usersWithSubscribees,
+		directSubscriptions:  directSubscriptions,
+		posts:                postsMap,
+	}, nil
+}
+
+// Recipients returns the users that are subscribed to anyone, sorted
+// by user name.
+func (s *Subscriptions) Recipients() []schema.User {
+	var recipients []schema.User
+	for subscriber := range s.usersWithSubscribees {
+		user, _ := s.Recipient(subscriber)
+		recipients = append(recipients, user)
+	}
+	sortUsers(recipients)
+	return recipients
+}
+
+// Recipient returns a user if they are subscribed to anyone.
+func (s *Subscriptions) Recipient(userName string) (schema.User, bool) {
+	if _, ok := s.usersWithSubscribees[userName]; !ok {
+		return schema.User{}, false
+	}
+	user := s.users[userName]
+	user.UserName = userName
+	return user, true
+}
+
+// unsubscribeUrl returns the link through which a subscriber can
+// unsubscribe from a subscribee, or from everyone if the subscribee is
+// empty. It returns an empty string if no such link can be provided.
+func (s *Subscriptions) unsubscribeUrl(subscriber string, subscribee string) string {
+	if s.Unsubscribe == nil || (subscribee != "" && !s.directSubscriptions[schema.Subscription{Subscriber: subscriber, Subscribee: subscribee}]) {
+		return ""
+	}
+	return s.Unsubscribe.Url(subscriber, subscribee)
+}
+
+// Kind returns the kind of the emails, as recorded in the deliveries
+// table.
+func (s *Subscriptions) Kind() string {
+	return schema.DeliveryKindSubscriptions
+}
+
+// getPosts returns the posts of the users a subscriber is subscribed to
+// as they may be read by the subscriber, and the users that did not
+// write a snippet. Subscribers may read snippets that are only visible
+// to subscribers, but not private snippets. Private lines are only
+// included for the author's manager.
+func (s *Subscriptions) getPosts(subscriber string) ([]schema.Post, []schema.User) {
+	var posts []schema.Post
+	var didNotWriteSnippets []schema.User
+	for _, subscribee := range s.usersWithSubscribees[subscriber] {
+		subscribeeUser := s.users[subscribee]
+		if post, ok := s.posts[subscribee]; ok && post.IsVisibleTo(subscriber, true) {
+			posts = append(posts, post.WithoutPrivateLinesFor(subscriber, subscribeeUser.Manager))
+		} else {
+			didNotWriteSnippets = append(didNotWriteSnippets, subscribeeUser)
+		}
+	}
+	return posts, didNotWriteSnippets
+}
+
+// Render the email that is sent to a subscriber.
+func (s *Subscriptions) Render(subscriber string, emailAddress string) (mail.Message, error) {
+	type Snippet struct {
+		UserName       string
+		RealName       string
+		BodyThisWeek   []template.HTML
+		BodyNextWeek   []template.HTML
+		UnsubscribeUrl string
+	}
+
+	posts, didNotWriteSnippets := s.getPosts(subscriber)
+	var snippets []Snippet
+	for _, post := range posts {
+		snippets = append(snippets, Snippet{
+			UserName:       post.UserName,
+			RealName:       s.users[post.UserName].RealName,
+			BodyThisWeek:   markdown.RenderPostBody(post.BodyThisWeek, post.IsMarkdown()),
+			BodyNextWeek:   markdown.RenderPostBody(post.BodyNextWeek, post.IsMarkdown()),
+			UnsubscribeUrl: s.unsubscribeUrl(subscriber, post.UserName),
+		})
+	}
+
+	body := bytes.NewBuffer([]byte{})
+	unsubscribeUrl := s.unsubscribeUrl(subscriber, "")
+	if err := subscriptionsEmailBody.Execute(body, struct {
+		SnippetsUrl         string
+		RealName            string
+		Week                dates.IsoWeek
+		Snippets            []Snippet
+		DidNotWriteSnippets []schema.User
+		UnsubscribeUrl      string
+	}{
+		SnippetsUrl:         s.SnippetsUrl,
+		RealName:            s.users[subscriber].RealName,
+		Week:                s.Week,
+		Snippets:            snippets,
+		DidNotWriteSnippets: didNotWriteSnippets,
+		UnsubscribeUrl:      unsubscribeUrl,
+	}); err != nil {
+		return mail.Message{}, err
+	}
+	text, err := s.RenderText(subscriber)
+	if err != nil {
+		return mail.Message{}, err
+	}
+	return mail.Message{
+		To:              netMail.Address{Name: s.users[subscriber].RealName, Address: emailAddress},
+		Subject:         fmt.Sprintf("Snippets for %s", s.Week),
+		ListUnsubscribe: unsubscribeUrl,
+		Text:            text,
+		HTML:            body.String(),
+	}, nil
+}
+
+// RenderText renders the contents of the email that is sent to a
+// subscriber as Markdown, for delivery through chat.
+func (s *Subscriptions) RenderText(subscriber string) (string, error) {
+	type Snippet struct {
+		UserName     string
+		RealName     string
+		BodyThisWeek []string
+		BodyNextWeek []string
+	}
+
+	posts, didNotWriteSnippets := s.getPosts(subscriber)
+	var snippets []Snippet
+	for _, post := range posts {
+		snippets = append(snippets, Snippet{
+			UserName:     post.UserName,
+			RealName:     s.users[post.UserName].RealName,
+			BodyThisWeek: markdown.SplitLines(post.BodyThisWeek),
+			BodyNextWeek: markdown.SplitLines(post.BodyNextWeek),
+		})
+	}
+
+	body := strings.Builder{}
+	if err := subscriptionsText.Execute(&body, struct {
+		SnippetsUrl         string
+		Week                dates.IsoWeek
+		Snippets            []Snippet
+		DidNotWriteSnippets []schema.User
+		UnsubscribeUrl      string
+	}{
+		SnippetsUrl:         s.SnippetsUrl,
+		Week:                s.Week,
+		Snippets:            snippets,
+		DidNotWriteSnippets: didNotWriteSnippets,
+		UnsubscribeUrl:      s.unsubscribeUrl(subscriber, ""),
+	}); err != nil {
+		return "", err
+	}
+	return body.String(), nil
+}
+
+var subscriptionsEmailBody = template.Must(template.New("email").Parse(
+	`<!DOCTYPE html>
+<html>
+	<head>
+		<title>Snippets</title>
+	</head>
+	<body>
+		<p>Hello {{.RealName}},</p>
+
+		<p>You are receiving this email, because you are subscribed to
+		one or more people on <a href="{{.SnippetsUrl}}">Snippets</a>.
+		This email contains copies of snippets that people you are subscribed to have written last week.</p>
+
+		{{$Week := .Week}}
+		{{$SnippetsUrl := .SnippetsUrl}}
+		{{range .Snippets}}
+			<hr/>
+			{{if .BodyThisWeek}}
+				<h2>What has {{.RealName}} been up to last week?</h2>
+				<ul>
+					{{range .BodyThisWeek}}
+						<li>{{.}}</li>
+					{{end}}
+				</ul>
+			{{end}}
+
+			{{if .BodyNextWeek}}
+				<h2>What are {{.RealName}}'s plans for this week?</h2>
+				<ul>
+					{{range .BodyNextWeek}}
+						<li>{{.}}</li>
+					{{end}}
+				</ul>
+			{{end}}
+			<p>
+				<a href="{{$SnippetsUrl}}{{.UserName}}/{{$Week}}">link</a>
+				{{if .UnsubscribeUrl}}&middot; <a href="{{.UnsubscribeUrl}}">unsubscribe from {{.RealName}}</a>{{end}}
+			</p>
+		{{end}}
+
+		{{if .DidNotWriteSnippets}}
+			<hr/>
+			<h2>People who did not write a snippet last week</h2>
+
+			<ul>
+				{{range .DidNotWriteSnippets}}
+					<li><a href="{{$SnippetsUrl}}{{.UserName}}/{{$Week}}">{{.RealName}}</a></li>
+				{{end}}
+			</ul>
+		{{end}}
+
+		{{if .UnsubscribeUrl}}
+			<hr/>
+			<p><small>Don't want to receive these emails anymore?
+			<a href="{{.UnsubscribeUrl}}">Unsubscribe from everyone</a>.</small></p>
+		{{end}}
+	</body>
+</html>`))
+
+var subscriptionsText = textTemplate.Must(textTemplate.New("text").Parse(
+	`**Snippets for {{.Week}}**
+{{$Week := .Week}}{{$SnippetsUrl := .SnippetsUrl}}{{range .Snippets}}
+[{{.RealName}}]({{$SnippetsUrl}}{{.UserName}}/{{$Week}}){{if .BodyThisWeek}}
+Last week:{{range .BodyThisWeek}}
+- {{.}}{{end}}{{end}}{{if .BodyNextWeek}}
+This week:{{range .BodyNextWeek}}
+- {{.}}{{end}}{{end}}
+{{end}}{{if .DidNotWriteSnippets}}
+Did not write a snippet:{{range .DidNotWriteSnippets}} {{.RealName}}{{end}}
+{{end}}{{if .UnsubscribeUrl}}
+Unsubscribe from everyone: {{.UnsubscribeUrl}}
+{{end}}`))
@@ -0,0 +1,40 @@
+package emails
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/url"
+)
+
+// UnsubscribeLinks generates and verifies the links in subscriptions
+// emails through which recipients can unsubscribe without logging in.
+// Links are signed using a key that is shared by the cron job and the
+// web application, so that they cannot be forged for other users.
+type UnsubscribeLinks struct {
+	SnippetsUrl string
+	Key         []byte
+}
+
+// sign computes the signature of a link. The subscribee is empty for
+// links that unsubscribe from everyone.
+func (ul *UnsubscribeLinks) sign(subscriber string, subscribee string) string {
+	mac := hmac.New(sha256.New, ul.Key)
+	mac.Write([]byte("unsubscribe\x00" + subscriber + "\x00" + subscribee))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Url returns the link through which a subscriber unsubscribes from a
+// subscribee, or from everyone if the subscribee is empty.
+func (ul *UnsubscribeLinks) Url(subscriber string, subscribee string) string {
+	path := "unsubscribe/" + url.PathEscape(subscriber)
+	if subscribee != "" {
+		path += "/" + url.PathEscape(subscribee)
+	}
+	return ul.SnippetsUrl + path + "?signature=" + ul.sign(subscriber, subscribee)
+}
+
+// Verify returns whether a signature is valid for a link.
+func (ul *UnsubscribeLinks) Verify(subscriber string, subscribee string, signature string) bool {
+	return len(ul.Key) > 0 && hmac.Equal([]byte(ul.sign(subscriber, subscribee)), []byte(signature))
+}
@@ -0,0 +1,101 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+)
+
+type jsonWebKey struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	Use     string `json:"use"`
+	N       string `json:"n"`
+	E       string `json:"e"`
+	Curve   string `json:"crv"`
+	X       string `json:"x"`
+	Y       string `json:"y"`
+}
+
+// KeySet contains the public keys of an issuer, indexed by key ID.
+type KeySet map[string]interface{}
+
+// ParseKeySet parses a JSON Web Key Set, as served by OpenID Connect
+// providers. Keys of unsupported types and keys that are not intended
+// for signing are ignored.
+func ParseKeySet(data []byte) (KeySet, error) {
+	var document struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+
+	keySet := KeySet{}
+	for _, key := range document.Keys {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+		switch key.KeyType {
+		case "RSA":
+			n, err := decodeInteger(key.N)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid modulus of key %#v: %s", key.KeyID, err)
+			}
+			e, err := decodeInteger(key.E)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid exponent of key %#v: %s", key.KeyID, err)
+			}
+			keySet[key.KeyID] = &rsa.PublicKey{N: n, E: int(e.Int64())}
+		case "EC":
+			var curve elliptic.Curve
+			switch key.Curve {
+			case "P-256":
+				curve = elliptic.P256()
+			case "P-384":
+				curve = elliptic.P384()
+			case "P-521":
+				curve = elliptic.P521()
+			default:
+				continue
+			}
+			x, err := decodeInteger(key.X)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid coordinate of key %#v: %s", key.KeyID, err)
+			}
+			y, err := decodeInteger(key.Y)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid coordinate of key %#v: %s", key.KeyID, err)
+			}
+			keySet[key.KeyID] = &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+		}
+	}
+	return keySet, nil
+}
+
+func decodeInteger(s string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(data), nil
+}
+
+// Key returns the key that should be used to verify a token. It can be
+// used as a KeyFunc.
+func (ks KeySet) Key(header Header) (interface{}, error) {
+	if key, ok := ks[header.KeyID]; ok {
+		return key, nil
+	}
+	// Issuers with a single key may omit key IDs.
+	if len(ks) == 1 && header.KeyID == "" {
+		for _, key := range ks {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("Unknown key %#v", header.KeyID)
+}
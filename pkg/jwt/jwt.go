@@ -0,0 +1,195 @@
+// Package jwt implements verification of JSON Web Tokens, as issued by
+// OpenID Connect providers and authenticating proxies.
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// Header of a JSON Web Token.
+type Header struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+}
+
+// Audience of a JSON Web Token. It may either be encoded as a single
+// string or as a list of strings.
+type Audience []string
+
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return err
+	}
+	*a = multiple
+	return nil
+}
+
+// Contains returns whether a recipient is part of the audience.
+func (a Audience) Contains(recipient string) bool {
+	for _, r := range a {
+		if r == recipient {
+			return true
+		}
+	}
+	return false
+}
+
+// Claims that are registered by RFC 7519 and used for validation.
+type Claims struct {
+	Issuer    string   `json:"iss"`
+	Subject   string   `json:"sub"`
+	Audience  Audience `json:"aud"`
+	Expiry    int64    `json:"exp"`
+	NotBefore int64    `json:"nbf"`
+	IssuedAt  int64    `json:"iat"`
+}
+
+// Maximum difference in clocks between the issuer and us.
+const clockSkew = time.Minute
+
+// Validate the registered claims of a token. The issuer and audience
+// are only checked if non-empty.
+func (c *Claims) Validate(issuer string, audience string, now time.Time) error {
+	if issuer != "" && c.Issuer != issuer {
+		return fmt.Errorf("Token has been issued by %#v instead of %#v", c.Issuer, issuer)
+	}
+	if audience != "" && !c.Audience.Contains(audience) {
+		return fmt.Errorf("Token is not intended for %#v", audience)
+	}
+	if c.Expiry == 0 {
+		return errors.New("Token has no expiration time")
+	}
+	if now.Add(-clockSkew).After(time.Unix(c.Expiry, 0)) {
+		return errors.New("Token has expired")
+	}
+	if c.NotBefore != 0 && now.Add(clockSkew).Before(time.Unix(c.NotBefore, 0)) {
+		return errors.New("Token is not valid yet")
+	}
+	return nil
+}
+
+// KeyFunc returns the key that should be used to verify the signature
+// of a token with a given header. For HMAC based algorithms, the key
+// must be a []byte. Otherwise it must be an *rsa.PublicKey or an
+// *ecdsa.PublicKey.
+type KeyFunc func(header Header) (interface{}, error)
+
+// Verify the signature of a token and decode its payload into claims.
+// Validation of the claims themselves is left to the caller.
+func Verify(token string, keyFunc KeyFunc, claims interface{}) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return errors.New("Token does not consist of three parts")
+	}
+	var header Header
+	if err := decodePart(parts[0], &header); err != nil {
+		return fmt.Errorf("Invalid token header: %s", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return fmt.Errorf("Invalid token signature: %s", err)
+	}
+	key, err := keyFunc(header)
+	if err != nil {
+		return err
+	}
+	if err := verifySignature(header.Algorithm, key, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return err
+	}
+	if err := decodePart(parts[1], claims); err != nil {
+		return fmt.Errorf("Invalid token payload: %s", err)
+	}
+	return nil
+}
+
+func decodePart(part string, value interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, value)
+}
+
+func newHash(algorithm string) (crypto.Hash, func() hash.Hash, error) {
+	switch algorithm[2:] {
+	case "256":
+		return crypto.SHA256, sha256.New, nil
+	case "384":
+		return crypto.SHA384, sha512.New384, nil
+	case "512":
+		return crypto.SHA512, sha512.New, nil
+	}
+	return 0, nil, fmt.Errorf("Unsupported signature algorithm %#v", algorithm)
+}
+
+func verifySignature(algorithm string, key interface{}, payload []byte, signature []byte) error {
+	if len(algorithm) != 5 {
+		return fmt.Errorf("Unsupported signature algorithm %#v", algorithm)
+	}
+	hashType, hashFunc, err := newHash(algorithm)
+	if err != nil {
+		return err
+	}
+
+	switch algorithm[:2] {
+	case "HS":
+		secret, ok := key.([]byte)
+		if !ok {
+			return fmt.Errorf("Key is not suitable for algorithm %#v", algorithm)
+		}
+		mac := hmac.New(hashFunc, secret)
+		mac.Write(payload)
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return errors.New("Invalid token signature")
+		}
+		return nil
+	case "RS":
+		publicKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("Key is not suitable for algorithm %#v", algorithm)
+		}
+		h := hashFunc()
+		h.Write(payload)
+		if err := rsa.VerifyPKCS1v15(publicKey, hashType, h.Sum(nil), signature); err != nil {
+			return errors.New("Invalid token signature")
+		}
+		return nil
+	case "ES":
+		publicKey, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("Key is not suitable for algorithm %#v", algorithm)
+		}
+		size := (publicKey.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return errors.New("Invalid token signature")
+		}
+		h := hashFunc()
+		h.Write(payload)
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(publicKey, h.Sum(nil), r, s) {
+			return errors.New("Invalid token signature")
+		}
+		return nil
+	}
+	return fmt.Errorf("Unsupported signature algorithm %#v", algorithm)
+}
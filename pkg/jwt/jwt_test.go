@@ -0,0 +1,323 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func encodePart(t *testing.T, value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// sign creates a token with a given header and payload. The signing key
+// determines how the token is signed, regardless of the algorithm in
+// the header, so that tokens with mismatching algorithms can be made.
+func sign(t *testing.T, header Header, payload interface{}, key interface{}) string {
+	signingInput := encodePart(t, header) + "." + encodePart(t, payload)
+	digest := sha256.Sum256([]byte(signingInput))
+	var signature []byte
+	switch key := key.(type) {
+	case nil:
+	case []byte:
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(signingInput))
+		signature = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		var err error
+		if signature, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:]); err != nil {
+			t.Fatal(err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature = make([]byte, 64)
+		rBytes, sBytes := r.Bytes(), s.Bytes()
+		copy(signature[32-len(rBytes):32], rBytes)
+		copy(signature[64-len(sBytes):], sBytes)
+	default:
+		t.Fatalf("Unsupported signing key %T", key)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestVerify(t *testing.T) {
+	secret := []byte("secret")
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherSecret := []byte("other secret")
+	claims := Claims{Subject: "alice"}
+
+	tests := []struct {
+		name         string
+		token        string
+		verification interface{}
+		expectedErr  string
+	}{
+		{
+			name:         "HS256",
+			token:        sign(t, Header{Algorithm: "HS256"}, claims, secret),
+			verification: secret,
+		},
+		{
+			name:         "RS256",
+			token:        sign(t, Header{Algorithm: "RS256"}, claims, rsaKey),
+			verification: &rsaKey.PublicKey,
+		},
+		{
+			name:         "ES256",
+			token:        sign(t, Header{Algorithm: "ES256"}, claims, ecKey),
+			verification: &ecKey.PublicKey,
+		},
+		{
+			name:         "None",
+			token:        sign(t, Header{Algorithm: "none"}, claims, nil),
+			verification: secret,
+			expectedErr:  "Unsupported signature algorithm",
+		},
+		{
+			name:         "WrongSecret",
+			token:        sign(t, Header{Algorithm: "HS256"}, claims, otherSecret),
+			verification: secret,
+			expectedErr:  "Invalid token signature",
+		},
+		{
+			// The public key of an RSA issuer must not be usable as
+			// an HMAC secret.
+			name:         "HS256WithRSAKey",
+			token:        sign(t, Header{Algorithm: "HS256"}, claims, secret),
+			verification: &rsaKey.PublicKey,
+			expectedErr:  "Key is not suitable",
+		},
+		{
+			name:         "RS256WithECKey",
+			token:        sign(t, Header{Algorithm: "RS256"}, claims, rsaKey),
+			verification: &ecKey.PublicKey,
+			expectedErr:  "Key is not suitable",
+		},
+		{
+			name:         "ES256WithSecret",
+			token:        sign(t, Header{Algorithm: "ES256"}, claims, ecKey),
+			verification: secret,
+			expectedErr:  "Key is not suitable",
+		},
+		{
+			name:         "UnsupportedHash",
+			token:        sign(t, Header{Algorithm: "HS257"}, claims, secret),
+			verification: secret,
+			expectedErr:  "Unsupported signature algorithm",
+		},
+		{
+			name:         "Malformed",
+			token:        "header.payload",
+			verification: secret,
+			expectedErr:  "three parts",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var decoded Claims
+			err := Verify(test.token, func(header Header) (interface{}, error) {
+				return test.verification, nil
+			}, &decoded)
+			if test.expectedErr == "" {
+				if err != nil {
+					t.Fatalf("Unexpected error: %s", err)
+				}
+				if decoded.Subject != "alice" {
+					t.Fatalf("Decoded subject %#v instead of %#v", decoded.Subject, "alice")
+				}
+			} else if err == nil || !strings.Contains(err.Error(), test.expectedErr) {
+				t.Fatalf("Expected error containing %#v, got %v", test.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestVerifyTamperedPayload(t *testing.T) {
+	secret := []byte("secret")
+	parts := strings.Split(sign(t, Header{Algorithm: "HS256"}, Claims{Subject: "alice"}, secret), ".")
+	parts[1] = encodePart(t, Claims{Subject: "mallory"})
+	var decoded Claims
+	if err := Verify(strings.Join(parts, "."), func(header Header) (interface{}, error) {
+		return secret, nil
+	}, &decoded); err == nil {
+		t.Fatal("Token with a tampered payload was accepted")
+	}
+}
+
+func TestClaimsValidate(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	valid := Claims{
+		Issuer:   "https://issuer",
+		Audience: Audience{"snippets"},
+		Expiry:   now.Add(time.Hour).Unix(),
+	}
+
+	tests := []struct {
+		name        string
+		modify      func(c *Claims)
+		expectedErr string
+	}{
+		{
+			name:   "Valid",
+			modify: func(c *Claims) {},
+		},
+		{
+			name:   "ValidWithinClockSkew",
+			modify: func(c *Claims) { c.Expiry = now.Add(-clockSkew / 2).Unix() },
+		},
+		{
+			name:   "MultipleAudiences",
+			modify: func(c *Claims) { c.Audience = Audience{"other", "snippets"} },
+		},
+		{
+			name:        "Expired",
+			modify:      func(c *Claims) { c.Expiry = now.Add(-time.Hour).Unix() },
+			expectedErr: "expired",
+		},
+		{
+			name:        "NoExpiry",
+			modify:      func(c *Claims) { c.Expiry = 0 },
+			expectedErr: "no expiration time",
+		},
+		{
+			name:        "NotValidYet",
+			modify:      func(c *Claims) { c.NotBefore = now.Add(time.Hour).Unix() },
+			expectedErr: "not valid yet",
+		},
+		{
+			name:        "WrongAudience",
+			modify:      func(c *Claims) { c.Audience = Audience{"other"} },
+			expectedErr: "not intended for",
+		},
+		{
+			name:        "WrongIssuer",
+			modify:      func(c *Claims) { c.Issuer = "https://attacker" },
+			expectedErr: "has been issued by",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			claims := valid
+			test.modify(&claims)
+			err := claims.Validate("https://issuer", "snippets", now)
+			if test.expectedErr == "" {
+				if err != nil {
+					t.Fatalf("Unexpected error: %s", err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), test.expectedErr) {
+				t.Fatalf("Expected error containing %#v, got %v", test.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestAudienceUnmarshalJSON(t *testing.T) {
+	for data, expected := range map[string]Audience{
+		`{"aud": "a"}`:        {"a"},
+		`{"aud": ["a", "b"]}`: {"a", "b"},
+	} {
+		var claims Claims
+		if err := json.Unmarshal([]byte(data), &claims); err != nil {
+			t.Fatal(err)
+		}
+		if strings.Join(claims.Audience, ",") != strings.Join(expected, ",") {
+			t.Errorf("Audience of %s decoded as %#v instead of %#v", data, claims.Audience, expected)
+		}
+	}
+}
+
+func TestRemoteKeySetRateLimitsRefreshes(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Write([]byte(`{"keys": []}`))
+	}))
+	defer server.Close()
+
+	rks := &RemoteKeySet{URL: server.URL, MinRefreshInterval: time.Hour}
+	for _, keyID := range []string{"a", "b", "c"} {
+		if _, err := rks.Key(Header{Algorithm: "RS256", KeyID: keyID}); err == nil {
+			t.Fatalf("Unknown key %#v was accepted", keyID)
+		}
+	}
+	if requests != 1 {
+		t.Fatalf("Key set was fetched %d times instead of once", requests)
+	}
+}
+
+func TestRemoteKeySetConcurrentRefresh(t *testing.T) {
+	var requests int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		<-release
+		w.Write([]byte(`{"keys": [{"kty": "RSA", "kid": "a", "n": "AQAB", "e": "AQAB"}]}`))
+	}))
+	defer server.Close()
+
+	rks := &RemoteKeySet{URL: server.URL, MinRefreshInterval: time.Hour}
+	errs := make(chan error)
+	for i := 0; i < 10; i++ {
+		go func() {
+			_, err := rks.Key(Header{Algorithm: "RS256", KeyID: "a"})
+			errs <- err
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	for i := 0; i < 10; i++ {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+	if requests != 1 {
+		t.Fatalf("Key set was fetched %d times instead of once", requests)
+	}
+}
+
+func TestRemoteKeySetRetriesFailedInitialFetch(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			http.Error(w, "Unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"keys": [{"kty": "RSA", "kid": "a", "n": "AQAB", "e": "AQAB"}]}`))
+	}))
+	defer server.Close()
+
+	rks := &RemoteKeySet{URL: server.URL, MinRefreshInterval: time.Hour}
+	header := Header{Algorithm: "RS256", KeyID: "a"}
+	if _, err := rks.Key(header); err == nil {
+		t.Fatal("Key was returned while the key set could not be fetched")
+	}
+	if _, err := rks.Key(header); err != nil {
+		t.Fatal(err)
+	}
+}
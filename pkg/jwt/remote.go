@@ -0,0 +1,117 @@
+package jwt
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultMinRefreshInterval is the minimum amount of time between two
+// fetches of a RemoteKeySet, unless configured otherwise.
+const DefaultMinRefreshInterval = time.Minute
+
+// Client used to fetch key sets if none is provided.
+var defaultClient = &http.Client{Timeout: 10 * time.Second}
+
+// RemoteKeySet is a key set that is fetched from a URL. The key set is
+// refetched when encountering an unknown key, as issuers rotate their
+// keys periodically. As key IDs are chosen by clients, refetches are
+// rate limited, so that tokens with random key IDs cannot be used to
+// flood the issuer with requests.
+type RemoteKeySet struct {
+	URL                string
+	Client             *http.Client
+	MinRefreshInterval time.Duration
+
+	lock        sync.Mutex
+	keys        KeySet
+	lastRefresh time.Time
+	refresh     *keySetRefresh
+}
+
+// keySetRefresh is a fetch of a RemoteKeySet that is in progress.
+// Concurrent requests for unknown keys wait for it to complete instead
+// of fetching the key set themselves.
+type keySetRefresh struct {
+	done chan struct{}
+	err  error
+}
+
+// fetch downloads and parses the key set.
+func (rks *RemoteKeySet) fetch() (KeySet, error) {
+	client := rks.Client
+	if client == nil {
+		client = defaultClient
+	}
+	resp, err := client.Get(rks.URL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Key set request failed with status %s", resp.Status)
+	}
+	return ParseKeySet(body)
+}
+
+// Key returns the key that should be used to verify a token. It can be
+// used as a KeyFunc.
+func (rks *RemoteKeySet) Key(header Header) (interface{}, error) {
+	minRefreshInterval := rks.MinRefreshInterval
+	if minRefreshInterval <= 0 {
+		minRefreshInterval = DefaultMinRefreshInterval
+	}
+
+	rks.lock.Lock()
+	key, err := rks.keys.Key(header)
+	if err == nil {
+		rks.lock.Unlock()
+		return key, nil
+	}
+
+	// Wait for a fetch that is already in progress.
+	if refresh := rks.refresh; refresh != nil {
+		rks.lock.Unlock()
+		<-refresh.done
+		return rks.keyAfterRefresh(header, refresh)
+	}
+
+	// Only rate limit refreshes once the key set has been fetched
+	// successfully, so that requests don't fail until then.
+	if rks.keys != nil && time.Since(rks.lastRefresh) < minRefreshInterval {
+		rks.lock.Unlock()
+		return nil, err
+	}
+	refresh := &keySetRefresh{done: make(chan struct{})}
+	rks.refresh = refresh
+	rks.lock.Unlock()
+
+	keys, err := rks.fetch()
+	rks.lock.Lock()
+	if err == nil {
+		rks.keys = keys
+	}
+	rks.lastRefresh = time.Now()
+	refresh.err = err
+	rks.refresh = nil
+	rks.lock.Unlock()
+	close(refresh.done)
+	return rks.keyAfterRefresh(header, refresh)
+}
+
+// keyAfterRefresh looks up a key after a fetch of the key set has
+// completed, returning the error of the fetch if it failed.
+func (rks *RemoteKeySet) keyAfterRefresh(header Header, refresh *keySetRefresh) (interface{}, error) {
+	if refresh.err != nil {
+		return nil, refresh.err
+	}
+	rks.lock.Lock()
+	defer rks.lock.Unlock()
+	return rks.keys.Key(header)
+}
@@ -0,0 +1,142 @@
+package mail
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Environment variable from which the SMTP password is read if no
+// password file is provided.
+const passwordEnvironmentVariable = "SNIPPETS_SMTP_PASSWORD"
+
+// SenderFlags are the command line flags that configure a Sender. They
+// are shared by all binaries that send emails, so that they can all be
+// configured in the same way.
+type SenderFlags struct {
+	smarthost    *string
+	from         *string
+	tlsMode      *string
+	caFile       *string
+	heloName     *string
+	auth         *string
+	username     *string
+	passwordFile *string
+	timeout      *time.Duration
+}
+
+// RegisterSenderFlags registers the command line flags of a Sender.
+func RegisterSenderFlags(flagSet *flag.FlagSet) *SenderFlags {
+	return &SenderFlags{
+		smarthost:    flagSet.String("smtp.smarthost", "", "SMTP server to use for sending emails, including its port number."),
+		from:         flagSet.String("smtp.from", "", "Source email address."),
+		tlsMode:      flagSet.String("smtp.tls", TLSModeAuto, "Whether to use TLS: \"auto\" to use STARTTLS if supported, \"starttls\" to require STARTTLS, \"tls\" for implicit TLS, or \"none\"."),
+		caFile:       flagSet.String("smtp.ca_file", "", "File containing the CA certificates used to verify the SMTP server, instead of the system's."),
+		heloName:     flagSet.String("smtp.helo_name", "", "Host name to send in the HELO command. Defaults to \"localhost\"."),
+		auth:         flagSet.String("smtp.auth", "", "Authentication mechanism: \"plain\", \"login\" or \"cram-md5\". No authentication is used if empty."),
+		username:     flagSet.String("smtp.username", "", "User name used for authentication."),
+		passwordFile: flagSet.String("smtp.password_file", "", "File containing the password used for authentication. If empty, the password is read from the "+passwordEnvironmentVariable+" environment variable."),
+		timeout:      flagSet.Duration("smtp.timeout", DefaultSendTimeout, "Time within which an email must be sent to the SMTP server, including connecting to it."),
+	}
+}
+
+// password returns the SMTP password from the password file or the
+// environment.
+func (sf *SenderFlags) password() (string, error) {
+	if *sf.passwordFile == "" {
+		return os.Getenv(passwordEnvironmentVariable), nil
+	}
+	password, err := ioutil.ReadFile(*sf.passwordFile)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(password), "\r\n"), nil
+}
+
+// NewSender returns a Sender configured by the command line flags. The
+// smarthost of the Sender is empty if none is configured.
+func (sf *SenderFlags) NewSender() (*Sender, error) {
+	if !IsValidTLSMode(*sf.tlsMode) {
+		return nil, fmt.Errorf("Invalid TLS mode %#v", *sf.tlsMode)
+	}
+	sender := &Sender{
+		Smarthost: *sf.smarthost,
+		From:      *sf.from,
+		TLSMode:   *sf.tlsMode,
+		HeloName:  *sf.heloName,
+		Timeout:   *sf.timeout,
+	}
+
+	if *sf.caFile != "" {
+		certificates, err := ioutil.ReadFile(*sf.caFile)
+		if err != nil {
+			return nil, err
+		}
+		rootCAs := x509.NewCertPool()
+		if !rootCAs.AppendCertsFromPEM(certificates) {
+			return nil, fmt.Errorf("No certificates found in %#v", *sf.caFile)
+		}
+		sender.TLSConfig = &tls.Config{RootCAs: rootCAs}
+	}
+
+	if *sf.auth != "" {
+		host, _, err := net.SplitHostPort(*sf.smarthost)
+		if err != nil {
+			return nil, fmt.Errorf("Authentication requires a smarthost: %s", err)
+		}
+		password, err := sf.password()
+		if err != nil {
+			return nil, err
+		}
+		switch *sf.auth {
+		case "plain":
+			sender.Auth = smtp.PlainAuth("", *sf.username, password, host)
+		case "login":
+			sender.Auth = LoginAuth(*sf.username, password, host)
+		case "cram-md5":
+			sender.Auth = smtp.CRAMMD5Auth(*sf.username, password)
+		default:
+			return nil, fmt.Errorf("Invalid authentication mechanism %#v", *sf.auth)
+		}
+	}
+	return sender, nil
+}
+
+// WorkerFlags are the command line flags that configure the retry
+// behaviour of a Worker. They are shared by all binaries that process
+// the outbound mail queue.
+type WorkerFlags struct {
+	maxAttempts    *int
+	initialBackoff *time.Duration
+	maxBackoff     *time.Duration
+}
+
+// RegisterWorkerFlags registers the command line flags of a Worker.
+func RegisterWorkerFlags(flagSet *flag.FlagSet) *WorkerFlags {
+	return &WorkerFlags{
+		maxAttempts:    flagSet.Int("smtp.max_attempts", DefaultMaxAttempts, "Number of attempts to send an email before giving up."),
+		initialBackoff: flagSet.Duration("smtp.initial_backoff", DefaultInitialBackoff, "Delay before retrying to send an email, doubled after every failed attempt."),
+		maxBackoff:     flagSet.Duration("smtp.max_backoff", DefaultMaxBackoff, "Maximum delay before retrying to send an email."),
+	}
+}
+
+// NewWorker returns a Worker configured by the command line flags,
+// which sends the messages in the queue through a given transport.
+func (wf *WorkerFlags) NewWorker(db *gorm.DB, transport Transport) *Worker {
+	return &Worker{
+		DB:             db,
+		Transport:      transport,
+		MaxAttempts:    *wf.maxAttempts,
+		InitialBackoff: *wf.initialBackoff,
+		MaxBackoff:     *wf.maxBackoff,
+	}
+}
@@ -0,0 +1,139 @@
+package mail
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// Display name that is used for the source address of messages.
+const fromName = "Snippets"
+
+// Message is an email message consisting of an HTML body and a plain
+// text alternative, for mail clients that don't display HTML.
+type Message struct {
+	// Source email address. It is displayed as being from Snippets.
+	From string
+	To   mail.Address
+	// Subject of the message, which may contain any Unicode
+	// characters.
+	Subject string
+	// Time at which the message was composed. The time at which the
+	// message is converted to bytes is used if zero.
+	Date time.Time
+	// Message-ID header, including angle brackets. A random one is
+	// generated if empty.
+	MessageID string
+	// URL through which the recipient can unsubscribe with a single
+	// POST request, as per RFC 8058. Optional.
+	ListUnsubscribe string
+
+	Text string
+	HTML string
+}
+
+// Header returns the header fields of the message that describe its
+// origin and contents, as they would be sent. Names and subjects
+// containing non-ASCII characters are encoded as per RFC 2047.
+func (m Message) Header() []string {
+	var header []string
+	if m.From != "" {
+		header = append(header, "From: "+(&mail.Address{Name: fromName, Address: m.From}).String())
+	}
+	header = append(header,
+		"To: "+m.To.String(),
+		"Subject: "+mime.QEncoding.Encode("utf-8", m.Subject))
+	if !m.Date.IsZero() {
+		header = append(header, "Date: "+m.Date.Format(time.RFC1123Z))
+	}
+	if m.MessageID != "" {
+		header = append(header, "Message-ID: "+m.MessageID)
+	}
+	if m.ListUnsubscribe != "" {
+		header = append(header,
+			"List-Unsubscribe: <"+m.ListUnsubscribe+">",
+			"List-Unsubscribe-Post: List-Unsubscribe=One-Click")
+	}
+	return append(header, "MIME-Version: 1.0")
+}
+
+// newMessageID generates a random Message-ID in the domain of the
+// source address.
+func newMessageID(from string) (string, error) {
+	domain := "snippets"
+	if i := strings.LastIndex(from, "@"); i >= 0 && i+1 < len(from) {
+		domain = from[i+1:]
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("<%s@%s>", hex.EncodeToString(id), domain), nil
+}
+
+// writePart writes a part of a multipart/alternative body, using
+// quoted-printable encoding so that lines are kept short.
+func writePart(writer *multipart.Writer, contentType string, body string) error {
+	part, err := writer.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {contentType + "; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return err
+	}
+	encoder := quotedprintable.NewWriter(part)
+	if _, err := encoder.Write([]byte(body)); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// Bytes returns the message in the format in which it is sent over
+// SMTP, including all of its headers.
+func (m Message) Bytes() ([]byte, error) {
+	if m.From == "" {
+		return nil, errors.New("Message has no source address")
+	}
+	if m.To.Address == "" {
+		return nil, errors.New("Message has no recipient")
+	}
+	if m.Date.IsZero() {
+		m.Date = time.Now()
+	}
+	if m.MessageID == "" {
+		messageID, err := newMessageID(m.From)
+		if err != nil {
+			return nil, err
+		}
+		m.MessageID = messageID
+	}
+
+	body := bytes.NewBuffer([]byte{})
+	writer := multipart.NewWriter(body)
+	if err := writePart(writer, "text/plain", m.Text); err != nil {
+		return nil, err
+	}
+	if err := writePart(writer, "text/html", m.HTML); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	message := bytes.NewBuffer([]byte{})
+	for _, field := range m.Header() {
+		message.WriteString(field + "\r\n")
+	}
+	fmt.Fprintf(message, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", writer.Boundary())
+	message.Write(body.Bytes())
+	return message.Bytes(), nil
+}
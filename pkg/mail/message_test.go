@@ -0,0 +1,144 @@
+package mail
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMessageHeader(t *testing.T) {
+	date := time.Date(2020, 1, 6, 9, 0, 0, 0, time.UTC)
+	for _, test := range []struct {
+		name     string
+		message  Message
+		expected []string
+	}{
+		{
+			name: "Minimal",
+			message: Message{
+				To:      mail.Address{Address: "alice@example.com"},
+				Subject: "Snippets",
+			},
+			expected: []string{
+				"To: <alice@example.com>",
+				"Subject: Snippets",
+				"MIME-Version: 1.0",
+			},
+		},
+		{
+			name: "Complete",
+			message: Message{
+				From:            "snippets@example.com",
+				To:              mail.Address{Name: "Alice", Address: "alice@example.com"},
+				Subject:         "Snippets",
+				Date:            date,
+				MessageID:       "<id@example.com>",
+				ListUnsubscribe: "https://snippets.example.com/unsubscribe/token",
+			},
+			expected: []string{
+				`From: "Snippets" <snippets@example.com>`,
+				`To: "Alice" <alice@example.com>`,
+				"Subject: Snippets",
+				"Date: Mon, 06 Jan 2020 09:00:00 +0000",
+				"Message-ID: <id@example.com>",
+				"List-Unsubscribe: <https://snippets.example.com/unsubscribe/token>",
+				"List-Unsubscribe-Post: List-Unsubscribe=One-Click",
+				"MIME-Version: 1.0",
+			},
+		},
+		{
+			name: "Unicode",
+			message: Message{
+				To:      mail.Address{Name: "Zoë", Address: "zoe@example.com"},
+				Subject: "Snippets van Zoë",
+			},
+			expected: []string{
+				"To: =?utf-8?q?Zo=C3=AB?= <zoe@example.com>",
+				"Subject: =?utf-8?q?Snippets_van_Zo=C3=AB?=",
+				"MIME-Version: 1.0",
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if header := test.message.Header(); !reflect.DeepEqual(header, test.expected) {
+				t.Errorf("Expected header %#v, got %#v", test.expected, header)
+			}
+		})
+	}
+}
+
+func TestMessageBytesRequiresAddresses(t *testing.T) {
+	for _, message := range []Message{
+		{To: mail.Address{Address: "alice@example.com"}},
+		{From: "snippets@example.com"},
+	} {
+		if _, err := message.Bytes(); err == nil {
+			t.Errorf("Message %#v was converted without an address", message)
+		}
+	}
+}
+
+func TestMessageBytes(t *testing.T) {
+	message := Message{
+		From:    "snippets@example.com",
+		To:      mail.Address{Address: "alice@example.com"},
+		Subject: "Snippets",
+		Text:    "Snippets of this week: " + strings.Repeat("=", 100),
+		HTML:    "<p>Snippets of this week</p>",
+	}
+	data, err := message.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if messageID := parsed.Header.Get("Message-ID"); !strings.HasSuffix(messageID, "@example.com>") {
+		t.Errorf("Message-ID %#v is not in the domain of the source address", messageID)
+	}
+	if _, err := parsed.Header.Date(); err != nil {
+		t.Errorf("Message has no valid date: %s", err)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mediaType != "multipart/alternative" {
+		t.Fatalf("Expected a multipart/alternative message, got %#v", mediaType)
+	}
+	reader := multipart.NewReader(parsed.Body, params["boundary"])
+	for _, expected := range []struct {
+		contentType string
+		body        string
+	}{
+		{"text/plain; charset=utf-8", message.Text},
+		{"text/html; charset=utf-8", message.HTML},
+	} {
+		part, err := reader.NextPart()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if contentType := part.Header.Get("Content-Type"); contentType != expected.contentType {
+			t.Errorf("Expected part of type %#v, got %#v", expected.contentType, contentType)
+		}
+		// The multipart reader decodes quoted-printable parts.
+		body, err := ioutil.ReadAll(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != expected.body {
+			t.Errorf("Expected body %#v, got %#v", expected.body, string(body))
+		}
+	}
+	if _, err := reader.NextPart(); err == nil {
+		t.Error("Message contains more than two parts")
+	}
+}
@@ -0,0 +1,203 @@
+package mail
+
+import (
+	"bytes"
+	"log"
+	"net/mail"
+	"time"
+
+	"github.com/ProdriveTechnologies/snippets/pkg/schema"
+	"github.com/jinzhu/gorm"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Defaults for the retry behaviour of a Worker.
+const (
+	DefaultMaxAttempts    = 8
+	DefaultInitialBackoff = time.Minute
+	DefaultMaxBackoff     = 6 * time.Hour
+)
+
+// Maximum number of messages that a worker attempts to send at once.
+const workerBatchSize = 100
+
+// Duration for which a worker claims a message while sending it, so
+// that other workers don't send the same message concurrently.
+const workerClaimDuration = 10 * time.Minute
+
+var (
+	queueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "snippets",
+		Subsystem: "mail_queue",
+		Name:      "pending_messages",
+		Help:      "Number of messages in the outbound mail queue that are waiting to be sent.",
+	})
+	queueFailed = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "snippets",
+		Subsystem: "mail_queue",
+		Name:      "failed_messages",
+		Help:      "Number of messages in the outbound mail queue that could not be sent after the maximum number of attempts.",
+	})
+	sendAttempts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "snippets",
+		Subsystem: "mail_queue",
+		Name:      "send_attempts_total",
+		Help:      "Number of attempts to send messages from the outbound mail queue.",
+	}, []string{"result"})
+)
+
+func init() {
+	prometheus.MustRegister(queueDepth, queueFailed, sendAttempts)
+}
+
+// Queue is a Transport that stores messages in the outbound mail queue
+// in the database. Messages are sent by a Worker, so that they are
+// retried if the SMTP server is temporarily unavailable.
+type Queue struct {
+	DB *gorm.DB
+}
+
+func (q *Queue) Send(to string, message []byte) error {
+	// The Message-ID is stored separately, so that the delivery of a
+	// weekly email can be updated if the message cannot be sent.
+	var messageID string
+	if parsed, err := mail.ReadMessage(bytes.NewReader(message)); err == nil {
+		messageID = parsed.Header.Get("Message-ID")
+	}
+	now := time.Now()
+	return q.DB.Create(&schema.OutboundEmail{
+		Recipient:     to,
+		Message:       message,
+		MessageID:     messageID,
+		CreatedAt:     now,
+		Status:        schema.OutboundEmailStatusPending,
+		NextAttemptAt: now,
+	}).Error
+}
+
+// Worker sends the messages in the outbound mail queue. Failed attempts
+// are retried with exponential backoff, until the maximum number of
+// attempts is reached. Fields that are left zero obtain their default
+// value.
+type Worker struct {
+	DB        *gorm.DB
+	Transport Transport
+
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// backoff returns the delay before retrying a message that failed to
+// be sent a given number of times.
+func (w *Worker) backoff(attempts int) time.Duration {
+	initialBackoff, maxBackoff := w.InitialBackoff, w.MaxBackoff
+	if initialBackoff <= 0 {
+		initialBackoff = DefaultInitialBackoff
+	}
+	if maxBackoff <= 0 {
+		maxBackoff = DefaultMaxBackoff
+	}
+	backoff := initialBackoff
+	for i := 1; i < attempts && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxBackoff {
+		return maxBackoff
+	}
+	return backoff
+}
+
+// claim marks a message as being sent by this worker. It returns false
+// if the message has been claimed by another worker in the meantime.
+func (w *Worker) claim(email *schema.OutboundEmail) (bool, error) {
+	claimedUntil := time.Now().Add(workerClaimDuration)
+	r := w.DB.Model(&schema.OutboundEmail{}).Where(
+		"id = ? AND status = ? AND next_attempt_at = ?", email.ID, schema.OutboundEmailStatusPending, email.NextAttemptAt).Update("next_attempt_at", claimedUntil)
+	if r.Error != nil {
+		return false, r.Error
+	}
+	email.NextAttemptAt = claimedUntil
+	return r.RowsAffected == 1, nil
+}
+
+// send attempts to send a single message, removing it from the queue
+// on success and scheduling a retry on failure.
+func (w *Worker) send(email schema.OutboundEmail) error {
+	sendErr := w.Transport.Send(email.Recipient, email.Message)
+	if sendErr == nil {
+		sendAttempts.WithLabelValues("success").Inc()
+		return w.DB.Delete(&email).Error
+	}
+	sendAttempts.WithLabelValues("failure").Inc()
+
+	maxAttempts := w.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = DefaultMaxAttempts
+	}
+	email.Attempts++
+	email.LastError = sendErr.Error()
+	if email.Attempts >= maxAttempts {
+		log.Printf("Giving up sending email to %s after %d attempts: %s", email.Recipient, email.Attempts, sendErr)
+		email.Status = schema.OutboundEmailStatusFailed
+		// Mark the delivery of the message as failed, so that it
+		// is sent again when the cron job is rerun.
+		if email.MessageID != "" {
+			if r := w.DB.Model(&schema.Delivery{}).Where("message_id = ?", email.MessageID).Update("status", schema.DeliveryStatusFailed); r.Error != nil {
+				return r.Error
+			}
+		}
+	} else {
+		log.Printf("Failed to send email to %s, retrying later: %s", email.Recipient, sendErr)
+		email.NextAttemptAt = time.Now().Add(w.backoff(email.Attempts))
+	}
+	return w.DB.Save(&email).Error
+}
+
+// updateMetrics exports the number of pending and failed messages.
+func (w *Worker) updateMetrics() error {
+	for status, gauge := range map[string]prometheus.Gauge{
+		schema.OutboundEmailStatusPending: queueDepth,
+		schema.OutboundEmailStatusFailed:  queueFailed,
+	} {
+		var count int
+		if r := w.DB.Model(&schema.OutboundEmail{}).Where("status = ?", status).Count(&count); r.Error != nil {
+			return r.Error
+		}
+		gauge.Set(float64(count))
+	}
+	return nil
+}
+
+// ProcessDue attempts to send all messages whose next attempt is due.
+func (w *Worker) ProcessDue() error {
+	for {
+		var emails []schema.OutboundEmail
+		if r := w.DB.Where("status = ? AND next_attempt_at <= ?", schema.OutboundEmailStatusPending, time.Now()).Order("next_attempt_at").Limit(workerBatchSize).Find(&emails); r.Error != nil {
+			return r.Error
+		}
+		for _, email := range emails {
+			if claimed, err := w.claim(&email); err != nil {
+				return err
+			} else if !claimed {
+				continue
+			}
+			if err := w.send(email); err != nil {
+				return err
+			}
+		}
+		if len(emails) < workerBatchSize {
+			return w.updateMetrics()
+		}
+	}
+}
+
+// Run processes the queue periodically. It never returns.
+func (w *Worker) Run(interval time.Duration) {
+	for {
+		if err := w.ProcessDue(); err != nil {
+			log.Print("Failed to process outbound mail queue: ", err)
+		}
+		time.Sleep(interval)
+	}
+}
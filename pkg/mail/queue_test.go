@@ -0,0 +1,29 @@
+package mail
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWorkerBackoff(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		worker   Worker
+		attempts int
+		expected time.Duration
+	}{
+		{"DefaultFirstRetry", Worker{}, 1, DefaultInitialBackoff},
+		{"DefaultThirdRetry", Worker{}, 3, 4 * DefaultInitialBackoff},
+		{"DefaultCapped", Worker{}, 20, DefaultMaxBackoff},
+		{"NoAttempts", Worker{InitialBackoff: time.Second}, 0, time.Second},
+		{"Custom", Worker{InitialBackoff: time.Second, MaxBackoff: time.Hour}, 5, 16 * time.Second},
+		{"CustomCapped", Worker{InitialBackoff: time.Second, MaxBackoff: 10 * time.Second}, 5, 10 * time.Second},
+		{"InitialExceedsMax", Worker{InitialBackoff: time.Hour, MaxBackoff: time.Minute}, 1, time.Minute},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if backoff := test.worker.backoff(test.attempts); backoff != test.expected {
+				t.Errorf("Expected backoff %s, got %s", test.expected, backoff)
+			}
+		})
+	}
+}
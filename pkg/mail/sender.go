@@ -0,0 +1,211 @@
+package mail
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"time"
+)
+
+// Default time within which a message must be sent, including
+// connecting to the smarthost.
+const DefaultSendTimeout = time.Minute
+
+// Ways in which a Sender may secure its connection to the smarthost.
+const (
+	// Use STARTTLS if the smarthost supports it.
+	TLSModeAuto = "auto"
+	// Require the smarthost to support STARTTLS.
+	TLSModeStartTLS = "starttls"
+	// Connect using TLS right away, typically on port 465.
+	TLSModeImplicit = "tls"
+	// Never use TLS.
+	TLSModeNone = "none"
+)
+
+// IsValidTLSMode returns whether a string is one of the TLS modes.
+func IsValidTLSMode(mode string) bool {
+	return mode == TLSModeAuto || mode == TLSModeStartTLS || mode == TLSModeImplicit || mode == TLSModeNone
+}
+
+// Sender of email messages through an SMTP smarthost. It is shared by
+// the cron jobs and the web application, so that all messages are
+// delivered in the same way.
+type Sender struct {
+	// Address of the SMTP server, including its port number.
+	Smarthost string
+	// Source email address of messages.
+	From string
+
+	// TLS mode, defaulting to TLSModeAuto if empty.
+	TLSMode string
+	// Configuration used for TLS connections, which may contain a
+	// custom set of root CAs. The server name is derived from the
+	// smarthost if not set.
+	TLSConfig *tls.Config
+	// Host name sent in the HELO or EHLO command, defaulting to
+	// "localhost" if empty.
+	HeloName string
+	// Authentication used after securing the connection, if any.
+	Auth smtp.Auth
+	// Time within which a message must be sent, defaulting to
+	// DefaultSendTimeout if zero, so that an unresponsive smarthost
+	// cannot stall the mail queue.
+	Timeout time.Duration
+}
+
+// tlsConfig returns the TLS configuration for connecting to the
+// smarthost.
+func (s *Sender) tlsConfig() (*tls.Config, error) {
+	host, _, err := net.SplitHostPort(s.Smarthost)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{}
+	if s.TLSConfig != nil {
+		config = s.TLSConfig.Clone()
+	}
+	if config.ServerName == "" {
+		config.ServerName = host
+	}
+	return config, nil
+}
+
+// dial connects to the smarthost, securing the connection using TLS
+// as configured.
+func (s *Sender) dial() (*smtp.Client, error) {
+	tlsMode := s.TLSMode
+	if tlsMode == "" {
+		tlsMode = TLSModeAuto
+	}
+	if !IsValidTLSMode(tlsMode) {
+		return nil, fmt.Errorf("Invalid TLS mode %#v", tlsMode)
+	}
+	config, err := s.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = DefaultSendTimeout
+	}
+	dialer := &net.Dialer{Timeout: timeout}
+	var conn net.Conn
+	if tlsMode == TLSModeImplicit {
+		conn, err = tls.DialWithDialer(dialer, "tcp", s.Smarthost, config)
+	} else {
+		conn, err = dialer.Dial("tcp", s.Smarthost)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// The deadline also covers the TLS handshake of STARTTLS and the
+	// remainder of the session, as the TLS connection wraps this one.
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	client, err := smtp.NewClient(conn, config.ServerName)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if s.HeloName != "" {
+		if err := client.Hello(s.HeloName); err != nil {
+			client.Close()
+			return nil, err
+		}
+	}
+	if tlsMode == TLSModeAuto || tlsMode == TLSModeStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(config); err != nil {
+				client.Close()
+				return nil, err
+			}
+		} else if tlsMode == TLSModeStartTLS {
+			client.Close()
+			return nil, errors.New("SMTP server does not support STARTTLS")
+		}
+	}
+	return client, nil
+}
+
+// Send a fully rendered message, including its headers, to a single
+// recipient.
+func (s *Sender) Send(to string, message []byte) error {
+	client, err := s.dial()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if s.Auth != nil {
+		if err := client.Auth(s.Auth); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(s.From); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(message); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// loginAuth implements the LOGIN authentication mechanism, which is
+// not provided by net/smtp but still required by some servers. Like
+// smtp.PlainAuth, it refuses to send credentials over unencrypted
+// connections to other hosts than localhost.
+type loginAuth struct {
+	username string
+	password string
+	host     string
+}
+
+// LoginAuth returns an Auth that implements the LOGIN authentication
+// mechanism.
+func LoginAuth(username string, password string, host string) smtp.Auth {
+	return &loginAuth{
+		username: username,
+		password: password,
+		host:     host,
+	}
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	isLocalhost := server.Name == "localhost" || server.Name == "127.0.0.1" || server.Name == "::1"
+	if !server.TLS && !isLocalhost {
+		return "", nil, errors.New("unencrypted connection")
+	}
+	if server.Name != a.host {
+		return "", nil, errors.New("wrong host name")
+	}
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	switch string(fromServer) {
+	case "Username:":
+		return []byte(a.username), nil
+	case "Password:":
+		return []byte(a.password), nil
+	}
+	return nil, fmt.Errorf("Unexpected LOGIN challenge %#v", string(fromServer))
+}
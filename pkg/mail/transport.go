@@ -0,0 +1,53 @@
+package mail
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// Transport delivers fully rendered messages, including their headers,
+// to a single recipient.
+type Transport interface {
+	Send(to string, message []byte) error
+}
+
+// Printer is a Transport that writes messages to a stream instead of
+// sending them.
+type Printer struct {
+	Writer io.Writer
+}
+
+func (p *Printer) Send(to string, message []byte) error {
+	_, err := fmt.Fprintf(p.Writer, "==> Message to %s\n%s\n", to, message)
+	return err
+}
+
+// DirectoryWriter is a Transport that stores messages in a directory
+// as .eml files instead of sending them. Files are numbered, so that
+// messages to the same recipient don't overwrite each other.
+type DirectoryWriter struct {
+	Directory string
+
+	count int
+}
+
+func (dw *DirectoryWriter) Send(to string, message []byte) error {
+	dw.count++
+	name := fmt.Sprintf("%04d-%s.eml", dw.count, strings.NewReplacer("/", "_", "\\", "_").Replace(to))
+	return ioutil.WriteFile(filepath.Join(dw.Directory, name), message, 0644)
+}
+
+// Redirector is a Transport that sends all messages to a single
+// address, regardless of their intended recipient. The headers of the
+// messages are left intact.
+type Redirector struct {
+	Transport Transport
+	To        string
+}
+
+func (r *Redirector) Send(to string, message []byte) error {
+	return r.Transport.Send(r.To, message)
+}
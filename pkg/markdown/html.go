@@ -0,0 +1,148 @@
+package markdown
+
+import (
+	"html"
+	"strings"
+
+	"github.com/ProdriveTechnologies/snippets/pkg/schema"
+)
+
+// Inline HTML tags that are converted to Markdown by FromHtml.
+var inlineTags = map[string]struct {
+	open  string
+	close string
+}{
+	"b":      {"**", "**"},
+	"strong": {"**", "**"},
+	"i":      {"*", "*"},
+	"em":     {"*", "*"},
+	"code":   {"`", "`"},
+}
+
+type openTag struct {
+	name     string
+	open     string
+	close    string
+	position int
+}
+
+// parseTag splits the contents of an HTML tag (without angle brackets)
+// into its lowercase name, whether it is a closing tag and the value of
+// its href attribute.
+func parseTag(tag string) (string, bool, string) {
+	closing := strings.HasPrefix(tag, "/")
+	fields := strings.Fields(strings.TrimSuffix(strings.TrimPrefix(tag, "/"), "/"))
+	if len(fields) == 0 {
+		return "", closing, ""
+	}
+	name := strings.ToLower(fields[0])
+	href := ""
+	rest := strings.Join(fields[1:], " ")
+	if i := strings.Index(strings.ToLower(rest), "href="); i >= 0 {
+		value := rest[i+5:]
+		if len(value) > 0 && (value[0] == '"' || value[0] == '\'') {
+			if end := strings.IndexByte(value[1:], value[0]); end >= 0 {
+				href = value[1 : end+1]
+			}
+		} else if end := strings.IndexAny(value, " >"); end >= 0 {
+			href = value[:end]
+		} else {
+			href = value
+		}
+	}
+	return name, closing, html.UnescapeString(href)
+}
+
+// FromHtml converts HTML, as generated by a contenteditable element in
+// a browser, to Markdown. Inline formatting and links are preserved,
+// while all other tags are converted to newlines. Text is escaped, so
+// that rendering the result yields the original text. Badges of
+// private lines, as generated by RenderPostBody, are converted back to
+// the marker of private lines.
+func FromHtml(code string) string {
+	code = strings.Replace(code, strings.TrimSuffix(privateLineBadge, " "), strings.TrimSuffix(schema.PrivateLinePrefix, " "), -1)
+	var out strings.Builder
+	var stack []openTag
+	result := func() string { return out.String() }
+	replace := func(s string) {
+		out.Reset()
+		out.WriteString(s)
+	}
+
+	// closeTag terminates a formatted span, moving surrounding
+	// whitespace outside of the delimiters. Spans that are empty or
+	// that contain line breaks are discarded.
+	closeTag := func(tag openTag, keep bool) {
+		s := result()
+		inner := s[tag.position+len(tag.open):]
+		trimmed := strings.TrimSpace(inner)
+		if !keep || trimmed == "" || strings.Contains(trimmed, "\n") {
+			replace(s[:tag.position] + inner)
+			return
+		}
+		leading := inner[:len(inner)-len(strings.TrimLeft(inner, " \t"))]
+		trailing := inner[len(strings.TrimRight(inner, " \t")):]
+		replace(s[:tag.position] + leading + tag.open + trimmed + tag.close + trailing)
+	}
+
+	for len(code) > 0 {
+		start := strings.IndexByte(code, '<')
+		if start < 0 {
+			start = len(code)
+		}
+		if start > 0 {
+			text := html.UnescapeString(code[:start])
+			if len(stack) > 0 && stack[len(stack)-1].name == "code" {
+				out.WriteString(strings.Replace(text, "`", "", -1))
+			} else {
+				out.WriteString(Escape(text))
+			}
+			code = code[start:]
+			continue
+		}
+
+		end := strings.IndexByte(code, '>')
+		if end < 0 {
+			break
+		}
+		name, closing, href := parseTag(code[1:end])
+		code = code[end+1:]
+
+		if name == "a" || inlineTags[name].open != "" {
+			if !closing {
+				tag := openTag{name: name, position: out.Len()}
+				if name == "a" {
+					if !IsSafeUrl(href) {
+						href = ""
+					}
+					tag.open, tag.close = "[", "]("+href+")"
+				} else {
+					tag.open, tag.close = inlineTags[name].open, inlineTags[name].close
+				}
+				out.WriteString(tag.open)
+				stack = append(stack, tag)
+				continue
+			}
+
+			// Close the most recently opened tag of the same kind,
+			// discarding any tags left open within it.
+			for i := len(stack) - 1; i >= 0; i-- {
+				if stack[i].name == name {
+					for j := len(stack) - 1; j > i; j-- {
+						closeTag(stack[j], false)
+					}
+					closeTag(stack[i], stack[i].close != "]()")
+					stack = stack[:i]
+					break
+				}
+			}
+			continue
+		}
+		out.WriteString("\n")
+	}
+
+	for i := len(stack) - 1; i >= 0; i-- {
+		closeTag(stack[i], false)
+	}
+	return result()
+}
@@ -0,0 +1,44 @@
+package markdown
+
+import (
+	"html/template"
+	"strings"
+	"testing"
+)
+
+// editorLines converts HTML submitted by the snippet editor back to
+// lines of Markdown, like the snippet edit form does.
+func editorLines(code string) []string {
+	var lines []string
+	for _, line := range strings.Split(FromHtml(code), "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+func listHtml(lines []template.HTML) string {
+	var code strings.Builder
+	code.WriteString("<ul>")
+	for _, line := range lines {
+		code.WriteString("<li>" + string(line) + "</li>")
+	}
+	code.WriteString("</ul>")
+	return code.String()
+}
+
+func TestPrivateLinesRoundTrip(t *testing.T) {
+	body := "public line\n!private secret plan\n!private **bold** and `code`"
+	for name, render := range map[string]func(string, bool) []template.HTML{
+		"RenderBody":     RenderBody,
+		"RenderPostBody": RenderPostBody,
+	} {
+		t.Run(name, func(t *testing.T) {
+			lines := editorLines(listHtml(render(body, true)))
+			if strings.Join(lines, "\n") != body {
+				t.Fatalf("Body %#v was converted to %#v", body, lines)
+			}
+		})
+	}
+}
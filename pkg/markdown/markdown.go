@@ -0,0 +1,214 @@
+// Package markdown implements the safe subset of inline Markdown that
+// may be used in the lines of a snippet: `code spans`, **strong
+// emphasis**, *emphasis* (or _emphasis_) and [links](https://...).
+// Block-level constructs are not supported, as every line of a snippet
+// is already rendered as an individual list item.
+package markdown
+
+import (
+	"html"
+	"html/template"
+	"net/url"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/ProdriveTechnologies/snippets/pkg/schema"
+)
+
+// Characters that may be escaped with a backslash.
+const escapableCharacters = "\\`*_[]()"
+
+// Escape converts plain text to Markdown that renders as the original
+// text, by escaping all characters that have a special meaning.
+func Escape(text string) string {
+	var out strings.Builder
+	for _, c := range text {
+		if strings.ContainsRune(escapableCharacters, c) {
+			out.WriteByte('\\')
+		}
+		out.WriteRune(c)
+	}
+	return out.String()
+}
+
+// IsSafeUrl returns whether a URL may be used as the target of a link.
+// Only absolute HTTP(S) and mailto URLs and site-relative paths are
+// permitted, so that links cannot be used to inject scripts.
+func IsSafeUrl(target string) bool {
+	if strings.HasPrefix(target, "/") && !strings.HasPrefix(target, "//") {
+		return true
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+		return u.Host != ""
+	case "mailto":
+		return u.Opaque != ""
+	}
+	return false
+}
+
+// Render converts a single line of Markdown to HTML. All text is
+// escaped, so that the resulting HTML only contains the tags generated
+// by the renderer itself.
+func Render(line string) template.HTML {
+	return template.HTML(render(line))
+}
+
+// PlainText converts a single line of Markdown to the text that it
+// renders as, without any formatting. Links are replaced by their text.
+func PlainText(line string) string {
+	rendered := render(line)
+	var out strings.Builder
+	for len(rendered) > 0 {
+		start := strings.IndexByte(rendered, '<')
+		if start < 0 {
+			out.WriteString(rendered)
+			break
+		}
+		out.WriteString(rendered[:start])
+		end := strings.IndexByte(rendered[start:], '>')
+		if end < 0 {
+			break
+		}
+		rendered = rendered[start+end+1:]
+	}
+	return html.UnescapeString(out.String())
+}
+
+// SplitLines returns the non-empty lines of a snippet body.
+func SplitLines(body string) []string {
+	var lines []string
+	for _, line := range strings.Split(body, "\n") {
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// RenderBody converts a snippet body to a list of HTML fragments, one
+// per non-empty line. Bodies that were stored before Markdown support
+// was added contain plain text, which is only escaped.
+func RenderBody(body string, isMarkdown bool) []template.HTML {
+	var lines []template.HTML
+	for _, line := range SplitLines(body) {
+		if isMarkdown {
+			lines = append(lines, Render(line))
+		} else {
+			lines = append(lines, template.HTML(html.EscapeString(line)))
+		}
+	}
+	return lines
+}
+
+// Badge that replaces the marker of private lines.
+const privateLineBadge = `<span class="badge badge-secondary">private</span> `
+
+// RenderPostBody converts the body of a post to a list of HTML
+// fragments like RenderBody, displaying the marker of private lines as
+// a badge. Private lines are only part of the bodies of posts read by
+// their author or the author's manager.
+func RenderPostBody(body string, isMarkdown bool) []template.HTML {
+	lines := RenderBody(body, isMarkdown)
+	escapedPrefix := html.EscapeString(schema.PrivateLinePrefix)
+	for i, line := range lines {
+		if strings.HasPrefix(string(line), escapedPrefix) {
+			lines[i] = template.HTML(privateLineBadge + strings.TrimPrefix(string(line), escapedPrefix))
+		}
+	}
+	return lines
+}
+
+// findClosing returns the offset of the first unescaped occurrence of
+// delimiter in s, requiring that it is not preceded by whitespace.
+func findClosing(s string, delimiter string) int {
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' {
+			i++
+			continue
+		}
+		if i > 0 && strings.HasPrefix(s[i:], delimiter) {
+			if r, _ := utf8.DecodeLastRuneInString(s[:i]); !unicode.IsSpace(r) {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// canOpen returns whether an emphasis delimiter at the start of s may
+// open a span. Underscores within words (e.g. snake_case) never do.
+func canOpen(s string, delimiter string, previous rune) bool {
+	r, _ := utf8.DecodeRuneInString(s[len(delimiter):])
+	if r == utf8.RuneError || unicode.IsSpace(r) {
+		return false
+	}
+	return delimiter[0] != '_' || !(unicode.IsLetter(previous) || unicode.IsDigit(previous))
+}
+
+func render(s string) string {
+	var out strings.Builder
+	previous := ' '
+	for len(s) > 0 {
+		consumed := 0
+		switch {
+		case s[0] == '\\' && len(s) > 1 && strings.IndexByte(escapableCharacters, s[1]) >= 0:
+			out.WriteString(html.EscapeString(s[1:2]))
+			consumed = 2
+		case s[0] == '`':
+			if end := strings.IndexByte(s[1:], '`'); end > 0 {
+				out.WriteString("<code>")
+				out.WriteString(html.EscapeString(s[1 : end+1]))
+				out.WriteString("</code>")
+				consumed = end + 2
+			}
+		case strings.HasPrefix(s, "**") || strings.HasPrefix(s, "__"):
+			delimiter := s[:2]
+			if canOpen(s, delimiter, previous) {
+				if end := findClosing(s[2:], delimiter); end > 0 {
+					out.WriteString("<strong>")
+					out.WriteString(render(s[2 : end+2]))
+					out.WriteString("</strong>")
+					consumed = end + 4
+				}
+			}
+		case s[0] == '*' || s[0] == '_':
+			delimiter := s[:1]
+			if canOpen(s, delimiter, previous) {
+				if end := findClosing(s[1:], delimiter); end > 0 {
+					out.WriteString("<em>")
+					out.WriteString(render(s[1 : end+1]))
+					out.WriteString("</em>")
+					consumed = end + 2
+				}
+			}
+		case s[0] == '[':
+			if middle := findClosing(s[1:], "]("); middle > 0 {
+				rest := s[middle+3:]
+				if end := strings.IndexByte(rest, ')'); end > 0 && IsSafeUrl(rest[:end]) {
+					out.WriteString("<a href=\"")
+					out.WriteString(html.EscapeString(rest[:end]))
+					out.WriteString("\">")
+					out.WriteString(render(s[1 : middle+1]))
+					out.WriteString("</a>")
+					consumed = middle + 3 + end + 1
+				}
+			}
+		}
+
+		if consumed == 0 {
+			// No markup. Emit the character as plain text.
+			_, size := utf8.DecodeRuneInString(s)
+			out.WriteString(html.EscapeString(s[:size]))
+			consumed = size
+		}
+		previous, _ = utf8.DecodeLastRuneInString(s[:consumed])
+		s = s[consumed:]
+	}
+	return out.String()
+}
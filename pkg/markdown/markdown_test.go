@@ -0,0 +1,189 @@
+package markdown
+
+import (
+	"html"
+	"html/template"
+	"reflect"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	for _, test := range []struct {
+		line     string
+		expected string
+	}{
+		{"", ""},
+		{"plain text", "plain text"},
+		{`a < b & "c"`, "a &lt; b &amp; &#34;c&#34;"},
+		{"**strong** and __strong__", "<strong>strong</strong> and <strong>strong</strong>"},
+		{"*em* and _em_", "<em>em</em> and <em>em</em>"},
+		{"**nested *em* span**", "<strong>nested <em>em</em> span</strong>"},
+		{"snake_case_name", "snake_case_name"},
+		{"** not strong**", "** not strong**"},
+		{"`a *b* <c>`", "<code>a *b* &lt;c&gt;</code>"},
+		{"`unterminated", "`unterminated"},
+		{`\*not em\* \\`, `*not em* \`},
+		{`\a`, `\a`},
+		{"[link](https://example.com/?a=1&b=2)", `<a href="https://example.com/?a=1&amp;b=2">link</a>`},
+		{"[**strong** link](/user)", `<a href="/user"><strong>strong</strong> link</a>`},
+		{"[unsafe](javascript:alert(1))", "[unsafe](javascript:alert(1))"},
+		{"[no target]", "[no target]"},
+	} {
+		if rendered := string(Render(test.line)); rendered != test.expected {
+			t.Errorf("%#v rendered as %#v instead of %#v", test.line, rendered, test.expected)
+		}
+	}
+}
+
+func TestIsSafeUrl(t *testing.T) {
+	for target, expected := range map[string]bool{
+		"/alice/2020-W01":      true,
+		"//example.com/":       false,
+		"https://example.com/": true,
+		"HTTP://example.com/":  true,
+		"https://":             false,
+		"mailto:a@example.com": true,
+		"mailto:":              false,
+		"javascript:alert(1)":  false,
+		"ftp://example.com/":   false,
+		"relative/path":        false,
+	} {
+		if IsSafeUrl(target) != expected {
+			t.Errorf("IsSafeUrl(%#v) != %v", target, expected)
+		}
+	}
+}
+
+func TestEscape(t *testing.T) {
+	for _, test := range []struct {
+		text     string
+		expected string
+	}{
+		{"plain text", "plain text"},
+		{"a*b_c", `a\*b\_c`},
+		{"[x](y)", `\[x\]\(y\)`},
+		{"`code`", "\\`code\\`"},
+		{`back\slash`, `back\\slash`},
+		{"<b>&amp;", "<b>&amp;"},
+	} {
+		escaped := Escape(test.text)
+		if escaped != test.expected {
+			t.Errorf("%#v escaped as %#v instead of %#v", test.text, escaped, test.expected)
+		}
+		// Escaped text renders as the original text.
+		if rendered := string(Render(escaped)); rendered != html.EscapeString(test.text) {
+			t.Errorf("%#v rendered as %#v instead of the original text", escaped, rendered)
+		}
+		if text := PlainText(escaped); text != test.text {
+			t.Errorf("%#v converted to plain text %#v instead of the original text", escaped, text)
+		}
+	}
+}
+
+func TestPlainText(t *testing.T) {
+	for _, test := range []struct {
+		line     string
+		expected string
+	}{
+		{"plain text", "plain text"},
+		{"**billing** migration", "billing migration"},
+		{`snake\_case`, "snake_case"},
+		{"`a < b`", "a < b"},
+		{"[docs](https://example.com/)", "docs"},
+		{"a & <b>", "a & <b>"},
+	} {
+		if text := PlainText(test.line); text != test.expected {
+			t.Errorf("%#v converted to plain text %#v instead of %#v", test.line, text, test.expected)
+		}
+	}
+}
+
+func TestSplitLines(t *testing.T) {
+	for _, test := range []struct {
+		body     string
+		expected []string
+	}{
+		{"", nil},
+		{"\n\n", nil},
+		{"single", []string{"single"}},
+		{"a\n\nb\n", []string{"a", "b"}},
+	} {
+		if lines := SplitLines(test.body); !reflect.DeepEqual(lines, test.expected) {
+			t.Errorf("%#v split as %#v instead of %#v", test.body, lines, test.expected)
+		}
+	}
+}
+
+// renderStrings adapts a function that renders a body to return strings.
+func renderStrings(render func(string, bool) []template.HTML) func(string, bool) []string {
+	return func(body string, isMarkdown bool) []string {
+		var lines []string
+		for _, line := range render(body, isMarkdown) {
+			lines = append(lines, string(line))
+		}
+		return lines
+	}
+}
+
+func TestRenderBody(t *testing.T) {
+	body := "**strong**\n\n!private <b>"
+	for _, test := range []struct {
+		name       string
+		render     func(string, bool) []string
+		isMarkdown bool
+		expected   []string
+	}{
+		{"Markdown", renderStrings(RenderBody), true, []string{"<strong>strong</strong>", "!private &lt;b&gt;"}},
+		{"Plain", renderStrings(RenderBody), false, []string{"**strong**", "!private &lt;b&gt;"}},
+		{"PostMarkdown", renderStrings(RenderPostBody), true, []string{"<strong>strong</strong>", privateLineBadge + "&lt;b&gt;"}},
+		{"PostPlain", renderStrings(RenderPostBody), false, []string{"**strong**", privateLineBadge + "&lt;b&gt;"}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if lines := test.render(body, test.isMarkdown); !reflect.DeepEqual(lines, test.expected) {
+				t.Errorf("Expected %#v, got %#v", test.expected, lines)
+			}
+		})
+	}
+}
+
+func TestFromHtml(t *testing.T) {
+	for _, test := range []struct {
+		code     string
+		expected string
+	}{
+		{"plain text", "plain text"},
+		{"1 &lt; 2 &amp; a*b", `1 < 2 & a\*b`},
+		{"<b>strong</b> <STRONG>strong</STRONG>", "**strong** **strong**"},
+		{"<i>em</i> <em>em</em>", "*em* *em*"},
+		{"a<strong> spaced </strong>b", "a **spaced** b"},
+		{"<code>a`b*c</code>", "`ab*c`"},
+		{`<a href="https://example.com/?a=1&amp;b=2">link</a>`, "[link](https://example.com/?a=1&b=2)"},
+		{`<a href='/alice'>link</a>`, "[link](/alice)"},
+		{`<a href="javascript:alert(1)">link</a>`, "link"},
+		{"<div>a</div><div>b</div>", "\na\n\nb\n"},
+		{"<b>a<br>b</b>", "a\nb"},
+		{"<b></b><i> </i>", " "},
+		{"<b>unclosed", "unclosed"},
+		{"<b><i>overlapping</b></i>", "**overlapping**"},
+		{"<span>text</span>", "\ntext\n"},
+		{"truncated <b", "truncated "},
+	} {
+		if markdown := FromHtml(test.code); markdown != test.expected {
+			t.Errorf("%#v converted to %#v instead of %#v", test.code, markdown, test.expected)
+		}
+	}
+}
+
+func TestRenderRoundTrip(t *testing.T) {
+	for _, line := range []string{
+		"plain text",
+		"**strong** and *em*",
+		"`code` and [link](https://example.com/)",
+		`snake\_case and 1 < 2 & 3`,
+		"[*em* link](/alice)",
+	} {
+		if markdown := FromHtml(string(Render(line))); markdown != line {
+			t.Errorf("%#v converted back to %#v", line, markdown)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+// Package notify delivers the weekly emails to users, either by email
+// or through a chat webhook, depending on the user's preferences.
+package notify
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/ProdriveTechnologies/snippets/pkg/mail"
+	"github.com/ProdriveTechnologies/snippets/pkg/schema"
+)
+
+// Notification that is delivered to a single user.
+type Notification struct {
+	// Kind of the notification, as recorded in the deliveries table.
+	Kind string
+	// Fully rendered email message, including its headers.
+	Message []byte
+	// Contents of the message as Markdown, for channels that don't
+	// support HTML.
+	Text string
+}
+
+// Notifier delivers notifications to users.
+type Notifier interface {
+	Notify(user schema.User, notification Notification) error
+}
+
+// EmailNotifier delivers notifications to the email address of users.
+type EmailNotifier struct {
+	Transport mail.Transport
+}
+
+func (en *EmailNotifier) Notify(user schema.User, notification Notification) error {
+	return en.Transport.Send(user.EmailAddress, notification.Message)
+}
+
+// Printer is a Notifier that writes the text of notifications to a
+// stream instead of delivering them.
+type Printer struct {
+	Writer io.Writer
+}
+
+func (p *Printer) Notify(user schema.User, notification Notification) error {
+	_, err := fmt.Fprintf(p.Writer, "==> Chat message to %s\n%s\n", user.UserName, notification.Text)
+	return err
+}
+
+// PreferenceNotifier delivers notifications through chat to users that
+// have configured a chat webhook and enabled chat delivery for the kind
+// of notification. All other users are notified by email.
+type PreferenceNotifier struct {
+	Email Notifier
+	Chat  Notifier
+	// Hosts to which chat webhooks may point. As webhooks are
+	// configured by users, this prevents them from making the cron jobs
+	// send requests to arbitrary internal services. Users whose webhook
+	// points elsewhere are notified by email.
+	AllowedChatHosts []string
+}
+
+func (pn *PreferenceNotifier) Notify(user schema.User, notification Notification) error {
+	if user.WantsChat(notification.Kind) && isAllowedWebhook(user.ChatWebhookUrl, pn.AllowedChatHosts) {
+		return pn.Chat.Notify(user, notification)
+	}
+	return pn.Email.Notify(user, notification)
+}
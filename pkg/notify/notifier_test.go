@@ -0,0 +1,72 @@
+package notify
+
+import (
+	"testing"
+
+	"github.com/ProdriveTechnologies/snippets/pkg/schema"
+)
+
+// recorder is a Notifier that records the names of the users that are
+// notified.
+type recorder struct {
+	userNames []string
+}
+
+func (r *recorder) Notify(user schema.User, notification Notification) error {
+	r.userNames = append(r.userNames, user.UserName)
+	return nil
+}
+
+func TestPreferenceNotifier(t *testing.T) {
+	tests := []struct {
+		name         string
+		user         schema.User
+		kind         string
+		expectedChat bool
+	}{
+		{
+			name:         "Chat",
+			user:         schema.User{ChatWebhookUrl: "https://chat.example.com/hooks/abc", ChatReminders: true},
+			kind:         schema.DeliveryKindReminder,
+			expectedChat: true,
+		},
+		{
+			name: "ChatDisabledForKind",
+			user: schema.User{ChatWebhookUrl: "https://chat.example.com/hooks/abc", ChatReminders: true},
+			kind: schema.DeliveryKindSubscriptions,
+		},
+		{
+			name: "NoWebhook",
+			user: schema.User{ChatReminders: true},
+			kind: schema.DeliveryKindReminder,
+		},
+		{
+			// Webhooks pointing to hosts that are not allowed fall
+			// back to email, instead of being requested.
+			name: "HostNotAllowed",
+			user: schema.User{ChatWebhookUrl: "http://internal/admin", ChatReminders: true},
+			kind: schema.DeliveryKindReminder,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			email, chat := &recorder{}, &recorder{}
+			pn := &PreferenceNotifier{
+				Email:            email,
+				Chat:             chat,
+				AllowedChatHosts: []string{"chat.example.com"},
+			}
+			test.user.UserName = "alice"
+			if err := pn.Notify(test.user, Notification{Kind: test.kind}); err != nil {
+				t.Fatal(err)
+			}
+			if test.expectedChat {
+				if len(chat.userNames) != 1 || len(email.userNames) != 0 {
+					t.Fatal("User was not notified through chat")
+				}
+			} else if len(chat.userNames) != 0 || len(email.userNames) != 1 {
+				t.Fatal("User was not notified by email")
+			}
+		})
+	}
+}
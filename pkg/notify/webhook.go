@@ -0,0 +1,71 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/ProdriveTechnologies/snippets/pkg/schema"
+)
+
+// WebhookNotifier delivers notifications to the chat webhook configured
+// by a user. The payload is compatible with the incoming webhooks of
+// Slack and Mattermost.
+type WebhookNotifier struct {
+	Client *http.Client
+}
+
+func (wn *WebhookNotifier) Notify(user schema.User, notification Notification) error {
+	payload, err := json.Marshal(struct {
+		Text string `json:"text"`
+	}{
+		Text: notification.Text,
+	})
+	if err != nil {
+		return err
+	}
+	// Redirects are not followed, as an allowed host that redirects
+	// elsewhere would otherwise bypass the list of allowed hosts.
+	var client http.Client
+	if wn.Client != nil {
+		client = *wn.Client
+	}
+	client.CheckRedirect = refuseRedirect
+	// Webhook URLs contain secrets, meaning they should not end up in
+	// error messages.
+	resp, err := client.Post(user.ChatWebhookUrl, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		if urlErr, ok := err.(*url.Error); ok {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("Failed to post to chat webhook: %s", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("Chat webhook returned status %s", resp.Status)
+	}
+	return nil
+}
+
+// refuseRedirect is a CheckRedirect function for HTTP clients that
+// makes them return redirect responses instead of following them.
+func refuseRedirect(req *http.Request, via []*http.Request) error {
+	return http.ErrUseLastResponse
+}
+
+// isAllowedWebhook returns whether a webhook URL points to one of a
+// list of hosts.
+func isAllowedWebhook(webhookUrl string, allowedHosts []string) bool {
+	u, err := url.Parse(webhookUrl)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") {
+		return false
+	}
+	for _, host := range allowedHosts {
+		if u.Host == host {
+			return true
+		}
+	}
+	return false
+}
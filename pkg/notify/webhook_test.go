@@ -0,0 +1,113 @@
+package notify
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ProdriveTechnologies/snippets/pkg/schema"
+)
+
+func TestWebhookNotifierPayload(t *testing.T) {
+	var contentType string
+	var payload map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		contentType = req.Header.Get("Content-Type")
+		if err := json.NewDecoder(req.Body).Decode(&payload); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer server.Close()
+
+	wn := &WebhookNotifier{}
+	if err := wn.Notify(schema.User{ChatWebhookUrl: server.URL + "/hooks/secret"}, Notification{
+		Kind: schema.DeliveryKindReminder,
+		Text: "Please write your *snippets*.",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if contentType != "application/json" {
+		t.Errorf("Payload sent with content type %#v", contentType)
+	}
+	if len(payload) != 1 || payload["text"] != "Please write your *snippets*." {
+		t.Errorf("Unexpected payload %#v", payload)
+	}
+}
+
+func TestWebhookNotifierErrors(t *testing.T) {
+	var redirected bool
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		redirected = true
+	}))
+	defer target.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/hooks/missing/secret":
+			http.NotFound(w, req)
+		case "/hooks/redirect/secret":
+			http.Redirect(w, req, target.URL, http.StatusTemporaryRedirect)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name        string
+		webhookUrl  string
+		expectedErr string
+	}{
+		{
+			name:        "NotFound",
+			webhookUrl:  server.URL + "/hooks/missing/secret",
+			expectedErr: "404",
+		},
+		{
+			name:        "Redirect",
+			webhookUrl:  server.URL + "/hooks/redirect/secret",
+			expectedErr: "307",
+		},
+		{
+			name:        "Unreachable",
+			webhookUrl:  "http://127.0.0.1:0/hooks/secret",
+			expectedErr: "Failed to post",
+		},
+	}
+	wn := &WebhookNotifier{Client: &http.Client{}}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := wn.Notify(schema.User{ChatWebhookUrl: test.webhookUrl}, Notification{Text: "Hello"})
+			if err == nil || !strings.Contains(err.Error(), test.expectedErr) {
+				t.Fatalf("Expected error containing %#v, got %v", test.expectedErr, err)
+			}
+			if strings.Contains(err.Error(), "secret") {
+				t.Fatalf("Error %#v contains the webhook URL", err.Error())
+			}
+		})
+	}
+	if redirected {
+		t.Error("Redirect of chat webhook was followed")
+	}
+}
+
+func TestIsAllowedWebhook(t *testing.T) {
+	allowedHosts := []string{"chat.example.com", "mattermost.example.com:8443"}
+	for webhookUrl, expected := range map[string]bool{
+		"https://chat.example.com/hooks/abc":             true,
+		"http://chat.example.com/hooks/abc":              true,
+		"https://mattermost.example.com:8443/hooks/abc":  true,
+		"https://mattermost.example.com/hooks/abc":       false,
+		"https://chat.example.com.attacker/hooks/abc":    false,
+		"https://attacker@internal/hooks/abc":            false,
+		"ftp://chat.example.com/hooks/abc":               false,
+		"chat.example.com/hooks/abc":                     false,
+		"":                                               false,
+		"https://chat.example.com:443/hooks/abc":         false,
+		"https://user@chat.example.com/hooks/abc":        true,
+		"https://internal/?u=https://chat.example.com/x": false,
+	} {
+		if isAllowedWebhook(webhookUrl, allowedHosts) != expected {
+			t.Errorf("isAllowedWebhook(%#v) did not return %t", webhookUrl, expected)
+		}
+	}
+}
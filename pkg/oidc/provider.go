@@ -0,0 +1,162 @@
+// Package oidc implements the client side of the OpenID Connect
+// authorization code flow.
+package oidc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ProdriveTechnologies/snippets/pkg/jwt"
+)
+
+// Provider is an OpenID Connect provider with which a client has been
+// registered.
+type Provider struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+
+	authorizationEndpoint string
+	tokenEndpoint         string
+	httpClient            *http.Client
+	keys                  *jwt.RemoteKeySet
+}
+
+// Discover the endpoints of an OpenID Connect provider, using its
+// configuration document.
+func Discover(issuer string, clientID string, clientSecret string, redirectURL string) (*Provider, error) {
+	p := &Provider{
+		Issuer:       issuer,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+		httpClient:   &http.Client{Timeout: 30 * time.Second},
+	}
+
+	var configuration struct {
+		Issuer                string `json:"issuer"`
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+		JwksURI               string `json:"jwks_uri"`
+	}
+	if err := p.getJSON(strings.TrimSuffix(issuer, "/")+"/.well-known/openid-configuration", &configuration); err != nil {
+		return nil, err
+	}
+	if configuration.Issuer != issuer {
+		return nil, fmt.Errorf("Provider reports issuer %#v instead of %#v", configuration.Issuer, issuer)
+	}
+	p.authorizationEndpoint = configuration.AuthorizationEndpoint
+	p.tokenEndpoint = configuration.TokenEndpoint
+	p.keys = &jwt.RemoteKeySet{
+		URL:    configuration.JwksURI,
+		Client: p.httpClient,
+	}
+	return p, nil
+}
+
+func (p *Provider) getJSON(url string, value interface{}) error {
+	resp, err := p.httpClient.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Request to %s failed with status %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(value)
+}
+
+// AuthCodeURL returns the URL to which users should be redirected to
+// log in. The state and nonce are echoed back to the redirect URL and
+// in the ID token, respectively.
+func (p *Provider) AuthCodeURL(state string, nonce string) string {
+	v := url.Values{
+		"response_type": {"code"},
+		"client_id":     {p.ClientID},
+		"redirect_uri":  {p.RedirectURL},
+		"scope":         {"openid profile email"},
+		"state":         {state},
+		"nonce":         {nonce},
+	}
+	separator := "?"
+	if strings.Contains(p.authorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return p.authorizationEndpoint + separator + v.Encode()
+}
+
+// Exchange an authorization code for an ID token. The ID token is
+// verified and its claims are returned.
+func (p *Provider) Exchange(code string, nonce string) (map[string]interface{}, error) {
+	req, err := http.NewRequest("POST", p.tokenEndpoint, strings.NewReader(url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {code},
+		"redirect_uri": {p.RedirectURL},
+	}.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Token request failed with status %s: %s", resp.Status, body)
+	}
+	var tokenResponse struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.Unmarshal(body, &tokenResponse); err != nil {
+		return nil, err
+	}
+	if tokenResponse.IDToken == "" {
+		return nil, errors.New("Token response contains no ID token")
+	}
+	return p.verifyIDToken(tokenResponse.IDToken, nonce)
+}
+
+func (p *Provider) verifyIDToken(idToken string, nonce string) (map[string]interface{}, error) {
+	var payload json.RawMessage
+	if err := jwt.Verify(idToken, p.getKey, &payload); err != nil {
+		return nil, err
+	}
+	var claims jwt.Claims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, err
+	}
+	if err := claims.Validate(p.Issuer, p.ClientID, time.Now()); err != nil {
+		return nil, err
+	}
+	var allClaims map[string]interface{}
+	if err := json.Unmarshal(payload, &allClaims); err != nil {
+		return nil, err
+	}
+	if allClaims["nonce"] != nonce {
+		return nil, errors.New("ID token contains an invalid nonce")
+	}
+	return allClaims, nil
+}
+
+// getKey returns the key with which an ID token has been signed.
+// Symmetric algorithms are rejected, as the client secret is not
+// suitable for verifying ID tokens.
+func (p *Provider) getKey(header jwt.Header) (interface{}, error) {
+	if strings.HasPrefix(header.Algorithm, "HS") {
+		return nil, fmt.Errorf("Unsupported signature algorithm %#v", header.Algorithm)
+	}
+	return p.keys.Key(header)
+}
@@ -0,0 +1,221 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testProvider is an OpenID Connect provider that issues a configurable
+// ID token in exchange for the authorization code "code".
+type testProvider struct {
+	server  *httptest.Server
+	key     *rsa.PrivateKey
+	idToken string
+}
+
+func newTestProvider(t *testing.T) *testProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tp := &testProvider{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, req *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 tp.server.URL,
+			"authorization_endpoint": tp.server.URL + "/authorize",
+			"token_endpoint":         tp.server.URL + "/token",
+			"jwks_uri":               tp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, req *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "key",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, req *http.Request) {
+		clientID, clientSecret, _ := req.BasicAuth()
+		if req.Method != "POST" || req.FormValue("code") != "code" || clientID != "snippets" || clientSecret != "secret" {
+			http.Error(w, `{"error": "invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": tp.idToken})
+	})
+	tp.server = httptest.NewServer(mux)
+	return tp
+}
+
+func encodePart(t *testing.T, value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// sign creates an ID token signed with the key of the provider, or
+// with an HMAC secret if provided.
+func (tp *testProvider) sign(t *testing.T, algorithm string, claims map[string]interface{}, secret []byte) string {
+	signingInput := encodePart(t, map[string]string{"alg": algorithm, "kid": "key"}) + "." + encodePart(t, claims)
+	var signature []byte
+	if secret != nil {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(signingInput))
+		signature = mac.Sum(nil)
+	} else {
+		digest := sha256.Sum256([]byte(signingInput))
+		var err error
+		if signature, err = rsa.SignPKCS1v15(rand.Reader, tp.key, crypto.SHA256, digest[:]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestDiscover(t *testing.T) {
+	tp := newTestProvider(t)
+	defer tp.server.Close()
+
+	p, err := Discover(tp.server.URL, "snippets", "secret", "https://snippets/auth/callback")
+	if err != nil {
+		t.Fatal(err)
+	}
+	authCodeURL, err := url.Parse(p.AuthCodeURL("state", "nonce"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if authCodeURL.Path != "/authorize" {
+		t.Errorf("Authorization URL has path %#v", authCodeURL.Path)
+	}
+	query := authCodeURL.Query()
+	for name, expected := range map[string]string{
+		"client_id":    "snippets",
+		"redirect_uri": "https://snippets/auth/callback",
+		"state":        "state",
+		"nonce":        "nonce",
+	} {
+		if query.Get(name) != expected {
+			t.Errorf("Authorization URL has %s %#v instead of %#v", name, query.Get(name), expected)
+		}
+	}
+
+	// The issuer reported by the provider must match the configured one.
+	if _, err := Discover(tp.server.URL+"/", "snippets", "secret", "https://snippets/auth/callback"); err == nil {
+		t.Error("Provider reporting a different issuer was accepted")
+	}
+}
+
+func TestExchange(t *testing.T) {
+	tp := newTestProvider(t)
+	defer tp.server.Close()
+	p, err := Discover(tp.server.URL, "snippets", "secret", "https://snippets/auth/callback")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	validClaims := func() map[string]interface{} {
+		return map[string]interface{}{
+			"iss":   tp.server.URL,
+			"sub":   "alice",
+			"aud":   "snippets",
+			"exp":   time.Now().Add(time.Hour).Unix(),
+			"nonce": "nonce",
+		}
+	}
+	tests := []struct {
+		name        string
+		code        string
+		algorithm   string
+		modify      func(claims map[string]interface{})
+		secret      []byte
+		expectedErr string
+	}{
+		{
+			name:      "Valid",
+			code:      "code",
+			algorithm: "RS256",
+			modify:    func(claims map[string]interface{}) {},
+		},
+		{
+			name:        "InvalidCode",
+			code:        "other",
+			algorithm:   "RS256",
+			modify:      func(claims map[string]interface{}) {},
+			expectedErr: "Token request failed",
+		},
+		{
+			name:        "WrongNonce",
+			code:        "code",
+			algorithm:   "RS256",
+			modify:      func(claims map[string]interface{}) { claims["nonce"] = "other" },
+			expectedErr: "invalid nonce",
+		},
+		{
+			name:        "MissingNonce",
+			code:        "code",
+			algorithm:   "RS256",
+			modify:      func(claims map[string]interface{}) { delete(claims, "nonce") },
+			expectedErr: "invalid nonce",
+		},
+		{
+			name:        "WrongAudience",
+			code:        "code",
+			algorithm:   "RS256",
+			modify:      func(claims map[string]interface{}) { claims["aud"] = "other" },
+			expectedErr: "not intended for",
+		},
+		{
+			name:        "Expired",
+			code:        "code",
+			algorithm:   "RS256",
+			modify:      func(claims map[string]interface{}) { claims["exp"] = time.Now().Add(-time.Hour).Unix() },
+			expectedErr: "expired",
+		},
+		{
+			// ID tokens signed using the client secret are rejected,
+			// as anyone knowing the secret could forge them.
+			name:        "SignedWithClientSecret",
+			code:        "code",
+			algorithm:   "HS256",
+			modify:      func(claims map[string]interface{}) {},
+			secret:      []byte("secret"),
+			expectedErr: "Unsupported signature algorithm",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			claims := validClaims()
+			test.modify(claims)
+			tp.idToken = tp.sign(t, test.algorithm, claims, test.secret)
+			exchanged, err := p.Exchange(test.code, "nonce")
+			if test.expectedErr == "" {
+				if err != nil {
+					t.Fatalf("Unexpected error: %s", err)
+				}
+				if exchanged["sub"] != "alice" {
+					t.Fatalf("Exchanged claims contain subject %#v", exchanged["sub"])
+				}
+			} else if err == nil || !strings.Contains(err.Error(), test.expectedErr) {
+				t.Fatalf("Expected error containing %#v, got %v", test.expectedErr, err)
+			}
+		})
+	}
+}
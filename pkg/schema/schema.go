@@ -1,20 +1,284 @@
 package schema
 
+import (
+	"strings"
+	"time"
+)
+
+// Formats in which the bodies of a post can be stored.
+const (
+	// Plain text. Used by posts written before Markdown support was added.
+	PostFormatPlain = ""
+	// The inline subset of Markdown implemented by pkg/markdown.
+	PostFormatMarkdown = "markdown"
+)
+
+// PrivateLinePrefix marks lines in the bodies of a post that are only
+// visible to the author and to the author's manager, regardless of the
+// visibility of the post as a whole.
+const PrivateLinePrefix = "!private "
+
+// IsPrivateLine returns whether a line of a body is private.
+func IsPrivateLine(line string) bool {
+	return strings.HasPrefix(line, PrivateLinePrefix)
+}
+
+// removePrivateLines returns a body without its private lines.
+func removePrivateLines(body string) string {
+	var lines []string
+	for _, line := range strings.Split(body, "\n") {
+		if !IsPrivateLine(line) {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Levels of visibility of a post.
+const (
+	// Visible to all users.
+	VisibilityPublic = "public"
+	// Only visible to subscribers of the author, either direct or
+	// through a team. As anyone may subscribe to anyone, this limits
+	// who sees a post without keeping it confidential.
+	VisibilitySubscribers = "subscribers"
+	// Only visible to the author.
+	VisibilityPrivate = "private"
+)
+
+// IsValidVisibility returns whether a string is a level of visibility.
+func IsValidVisibility(visibility string) bool {
+	return visibility == VisibilityPublic || visibility == VisibilitySubscribers || visibility == VisibilityPrivate
+}
+
 type Post struct {
-	UserName     string `gorm:"primary_key"`
-	Year         int    `gorm:"primary_key"`
-	Week         int    `gorm:"primary_key"`
-	BodyThisWeek string
-	BodyNextWeek string
+	UserName     string `gorm:"primary_key" json:"user_name"`
+	Year         int    `gorm:"primary_key" json:"year"`
+	Week         int    `gorm:"primary_key" json:"week"`
+	BodyThisWeek string `json:"body_this_week"`
+	BodyNextWeek string `json:"body_next_week"`
+	Format       string `json:"format"`
+	// Number of the revision that corresponds to the current contents.
+	// It is derived from the revisions of the post, instead of being
+	// stored along with it.
+	Version    int    `gorm:"-" json:"version"`
+	Visibility string `gorm:"default:'public'" json:"visibility"`
+}
+
+// IsMarkdown returns whether the bodies of the post contain Markdown.
+func (p Post) IsMarkdown() bool {
+	return p.Format == PostFormatMarkdown
+}
+
+// IsVisibleTo returns whether the post may be read by a user. The user
+// is related to the author if they are subscribed to the author, either
+// directly or through a team.
+func (p Post) IsVisibleTo(userName string, isRelated bool) bool {
+	switch p.Visibility {
+	case VisibilityPublic:
+		return true
+	case VisibilitySubscribers:
+		return userName == p.UserName || isRelated
+	}
+	return userName == p.UserName
+}
+
+// WithoutPrivateLinesFor returns the post as it may be read by a user.
+// Private lines are removed, unless the user is the author or the
+// author's manager, whose user name is provided.
+func (p Post) WithoutPrivateLinesFor(userName string, manager string) Post {
+	if userName == p.UserName || (manager != "" && userName == manager) {
+		return p
+	}
+	p.BodyThisWeek = removePrivateLines(p.BodyThisWeek)
+	p.BodyNextWeek = removePrivateLines(p.BodyNextWeek)
+	return p
+}
+
+// PostRevision is a copy of a post, stored every time the post is
+// saved. Revisions in which both bodies are empty correspond to the
+// post being deleted.
+type PostRevision struct {
+	UserName     string    `gorm:"primary_key" json:"user_name"`
+	Year         int       `gorm:"primary_key" json:"year"`
+	Week         int       `gorm:"primary_key" json:"week"`
+	Revision     int       `gorm:"primary_key" json:"revision"`
+	Author       string    `json:"author"`
+	CreatedAt    time.Time `json:"created_at"`
+	BodyThisWeek string    `json:"body_this_week"`
+	BodyNextWeek string    `json:"body_next_week"`
+	Format       string    `json:"format"`
+}
+
+// IsDeletion returns whether the revision corresponds to the post
+// being deleted.
+func (pr PostRevision) IsDeletion() bool {
+	return pr.BodyThisWeek == "" && pr.BodyNextWeek == ""
+}
+
+// Outcomes of a plan that a user wrote for the next week.
+const (
+	// The plan has been carried out.
+	PlanOutcomeDone = "done"
+	// The plan has not been carried out yet, and has been added to
+	// the plans for the week after.
+	PlanOutcomeCarriedOver = "carried_over"
+	// The plan has been abandoned.
+	PlanOutcomeDropped = "dropped"
+)
+
+// IsValidPlanOutcome returns whether a string is an outcome of a plan.
+func IsValidPlanOutcome(outcome string) bool {
+	return outcome == PlanOutcomeDone || outcome == PlanOutcomeCarriedOver || outcome == PlanOutcomeDropped
+}
+
+// PlanOutcome links a line of a post's BodyNextWeek to the post of the
+// following week, recording whether the plan has been carried out. The
+// week is the one for which the plan was made.
+type PlanOutcome struct {
+	UserName string `gorm:"primary_key" json:"user_name"`
+	Year     int    `gorm:"primary_key" json:"year"`
+	Week     int    `gorm:"primary_key" json:"week"`
+	// Line number of the plan within the preceding week's BodyNextWeek.
+	Position int    `gorm:"primary_key" json:"position"`
+	Plan     string `json:"plan"`
+	Outcome  string `json:"outcome"`
+	// Number of weeks for which the plan had already been carried
+	// over before this outcome was recorded.
+	CarriedWeeks int `json:"carried_weeks"`
+}
+
+// Comment left on the post of a user for a given week. Comments may be
+// replies to other comments, forming threads.
+type Comment struct {
+	ID        int64     `gorm:"primary_key" json:"id"`
+	UserName  string    `json:"user_name"`
+	Year      int       `json:"year"`
+	Week      int       `json:"week"`
+	Author    string    `json:"author"`
+	ParentID  *int64    `json:"parent_id"`
+	CreatedAt time.Time `json:"created_at"`
+	Body      string    `json:"body"`
 }
 
 type Subscription struct {
-	Subscriber string `gorm:"primary_key"`
-	Subscribee string `gorm:"primary_key"`
+	Subscriber string `gorm:"primary_key" json:"subscriber"`
+	Subscribee string `gorm:"primary_key" json:"subscribee"`
 }
 
 type User struct {
-	UserName     string `gorm:"primary_key"`
-	RealName     string
-	EmailAddress string
+	UserName     string `gorm:"primary_key" json:"user_name"`
+	RealName     string `json:"real_name"`
+	EmailAddress string `json:"email_address"`
+	// Visibility of posts that the user creates.
+	DefaultVisibility string `gorm:"default:'public'" json:"default_visibility"`
+	// User name of the user's manager, who may read the private lines
+	// of the user's posts. Empty if the user has no manager.
+	Manager string `json:"manager"`
+	// Incoming webhook of a chat service, through which the user may
+	// receive weekly emails instead. Webhook URLs are secrets.
+	ChatWebhookUrl    string `json:"-"`
+	ChatReminders     bool   `json:"-"`
+	ChatSubscriptions bool   `json:"-"`
+}
+
+// WantsChat returns whether the user wants to receive weekly emails of
+// a given kind through chat.
+func (u User) WantsChat(kind string) bool {
+	if u.ChatWebhookUrl == "" {
+		return false
+	}
+	switch kind {
+	case DeliveryKindReminder:
+		return u.ChatReminders
+	case DeliveryKindSubscriptions:
+		return u.ChatSubscriptions
+	}
+	return false
+}
+
+// FeedToken grants feed readers access to a user's Atom feeds. Only the
+// hash of the token is stored.
+type FeedToken struct {
+	UserName  string `gorm:"primary_key"`
+	TokenHash string
+	CreatedAt time.Time
+}
+
+// ApiToken permits scripts and other non-browser clients to act on
+// behalf of a user. Only the hash of the token is stored.
+type ApiToken struct {
+	ID          int64 `gorm:"primary_key"`
+	UserName    string
+	Description string
+	TokenHash   string
+	CreatedAt   time.Time
+	LastUsedAt  *time.Time
+}
+
+// Kinds of emails that are sent on a weekly basis.
+const (
+	DeliveryKindSubscriptions = "subscriptions"
+	DeliveryKindReminder      = "reminder"
+)
+
+// States of the delivery of an email.
+const (
+	DeliveryStatusSent   = "sent"
+	DeliveryStatusFailed = "failed"
+)
+
+// Delivery records whether a weekly email has been sent to a user, so
+// that emails are neither sent twice nor skipped when a cron job is
+// rerun. Emails that have been added to the outbound mail queue are
+// considered to be sent, until the queue gives up sending them.
+type Delivery struct {
+	Recipient string `gorm:"primary_key"`
+	Kind      string `gorm:"primary_key"`
+	Year      int    `gorm:"primary_key"`
+	Week      int    `gorm:"primary_key"`
+	Status    string
+	Attempts  int
+	MessageID string
+	UpdatedAt time.Time
+}
+
+// States of an email in the outbound mail queue. Emails are removed
+// from the queue once they have been sent.
+const (
+	OutboundEmailStatusPending = "pending"
+	OutboundEmailStatusFailed  = "failed"
+)
+
+// OutboundEmail is a fully rendered message in the outbound mail queue,
+// which is retried until it has been sent or too many attempts failed.
+type OutboundEmail struct {
+	ID            int64 `gorm:"primary_key"`
+	Recipient     string
+	Message       []byte
+	CreatedAt     time.Time
+	Status        string
+	Attempts      int
+	NextAttemptAt time.Time
+	LastError     string
+	// Message-ID header of the message, linking it to its delivery
+	// if it is a weekly email.
+	MessageID string
+}
+
+// Team is a named group of users, allowing others to subscribe to all
+// of its members at once.
+type Team struct {
+	Name        string `gorm:"primary_key" json:"name"`
+	Description string `json:"description"`
+}
+
+type TeamMember struct {
+	TeamName string `gorm:"primary_key" json:"team_name"`
+	UserName string `gorm:"primary_key" json:"user_name"`
+}
+
+type TeamSubscription struct {
+	Subscriber string `gorm:"primary_key" json:"subscriber"`
+	TeamName   string `gorm:"primary_key" json:"team_name"`
 }
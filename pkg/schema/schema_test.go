@@ -0,0 +1,74 @@
+package schema
+
+import "testing"
+
+func TestPostIsVisibleTo(t *testing.T) {
+	for _, test := range []struct {
+		visibility string
+		userName   string
+		isRelated  bool
+		expected   bool
+	}{
+		{VisibilityPublic, "alice", false, true},
+		{VisibilityPublic, "bob", false, true},
+		{VisibilitySubscribers, "alice", false, true},
+		{VisibilitySubscribers, "bob", true, true},
+		{VisibilitySubscribers, "bob", false, false},
+		{VisibilitySubscribers, "", false, false},
+		{VisibilityPrivate, "alice", false, true},
+		{VisibilityPrivate, "bob", true, false},
+		{"unknown", "bob", true, false},
+		{"unknown", "alice", false, true},
+	} {
+		post := Post{UserName: "alice", Visibility: test.visibility}
+		if visible := post.IsVisibleTo(test.userName, test.isRelated); visible != test.expected {
+			t.Errorf("Post with visibility %#v visible to %#v (related: %v): expected %v, got %v",
+				test.visibility, test.userName, test.isRelated, test.expected, visible)
+		}
+	}
+}
+
+func TestPostWithoutPrivateLinesFor(t *testing.T) {
+	post := Post{
+		UserName:     "alice",
+		BodyThisWeek: "public\n!private secret\n !private indented",
+		BodyNextWeek: "!private plan",
+	}
+	withoutPrivateLines := Post{
+		UserName:     "alice",
+		BodyThisWeek: "public\n !private indented",
+		BodyNextWeek: "",
+	}
+	for _, test := range []struct {
+		userName string
+		manager  string
+		expected Post
+	}{
+		{"alice", "", post},
+		{"alice", "carol", post},
+		{"carol", "carol", post},
+		{"bob", "carol", withoutPrivateLines},
+		{"bob", "", withoutPrivateLines},
+		{"", "", withoutPrivateLines},
+	} {
+		if readable := post.WithoutPrivateLinesFor(test.userName, test.manager); readable != test.expected {
+			t.Errorf("Post read by %#v with manager %#v: expected %#v, got %#v",
+				test.userName, test.manager, test.expected, readable)
+		}
+	}
+}
+
+func TestIsPrivateLine(t *testing.T) {
+	for line, expected := range map[string]bool{
+		"!private secret": true,
+		"!private ":       true,
+		"!private":        false,
+		"!privates":       false,
+		" !private x":     false,
+		"public":          false,
+	} {
+		if IsPrivateLine(line) != expected {
+			t.Errorf("IsPrivateLine(%#v) != %v", line, expected)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/ProdriveTechnologies/snippets/pkg/dates"
+)
+
+// Query is a parsed full-text search query. A post matches a query if
+// all of its terms occur in either of its bodies and it satisfies the
+// user and date range filters.
+type Query struct {
+	// Lowercase words and phrases that need to be present.
+	Terms []string
+	// Only match posts of this user, if non-empty.
+	UserName string
+	// Only match posts in this range of weeks, if set.
+	From *dates.IsoWeek
+	To   *dates.IsoWeek
+}
+
+// ParseQuery converts a query string to a Query. Words may be grouped
+// into phrases by placing them between double quotes. Filters may be
+// specified as "user:name", "from:2006-W01" and "to:2006-W52".
+// Malformed filters are treated as ordinary words.
+func ParseQuery(input string) Query {
+	var query Query
+	for len(input) > 0 {
+		input = strings.TrimLeft(input, " \t\r\n")
+		if input == "" {
+			break
+		}
+
+		// Phrases enclosed in double quotes.
+		if input[0] == '"' {
+			input = input[1:]
+			end := strings.IndexByte(input, '"')
+			if end < 0 {
+				end = len(input)
+			}
+			if phrase := normalizeTerm(input[:end]); phrase != "" {
+				query.Terms = append(query.Terms, phrase)
+			}
+			if end < len(input) {
+				end++
+			}
+			input = input[end:]
+			continue
+		}
+
+		// Individual words and filters.
+		end := strings.IndexAny(input, " \t\r\n")
+		if end < 0 {
+			end = len(input)
+		}
+		word := input[:end]
+		input = input[end:]
+		if !query.applyFilter(word) {
+			if term := normalizeTerm(word); term != "" {
+				query.Terms = append(query.Terms, term)
+			}
+		}
+	}
+	return query
+}
+
+func (q *Query) applyFilter(word string) bool {
+	parts := strings.SplitN(word, ":", 2)
+	if len(parts) != 2 {
+		return false
+	}
+	switch parts[0] {
+	case "user":
+		if parts[1] == "" {
+			return false
+		}
+		q.UserName = parts[1]
+	case "from":
+		week := dates.ParseIsoWeekString(parts[1])
+		if week == nil {
+			return false
+		}
+		q.From = week
+	case "to":
+		week := dates.ParseIsoWeekString(parts[1])
+		if week == nil {
+			return false
+		}
+		q.To = week
+	default:
+		return false
+	}
+	return true
+}
+
+func normalizeTerm(term string) string {
+	return strings.ToLower(strings.Join(strings.Fields(term), " "))
+}
+
+// Words returns the words contained in the terms of the query, being
+// runs of letters and digits. As Markdown formatting may occur within
+// a term (e.g. "snake\_case" or "**billing** migration"), the Markdown
+// of a matching post contains all words of the query, but not
+// necessarily its terms. Words can thus be used to preselect posts in
+// the database.
+func (q Query) Words() []string {
+	var words []string
+	seen := map[string]bool{}
+	for _, term := range q.Terms {
+		for _, word := range strings.FieldsFunc(term, func(c rune) bool {
+			return !unicode.IsLetter(c) && !unicode.IsDigit(c)
+		}) {
+			if !seen[word] {
+				words = append(words, word)
+				seen[word] = true
+			}
+		}
+	}
+	return words
+}
+
+// EscapeLikePattern escapes a string, so that it can be embedded in a
+// SQL LIKE pattern without its characters acting as wildcards.
+func EscapeLikePattern(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,51 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ProdriveTechnologies/snippets/pkg/dates"
+)
+
+func TestParseQuery(t *testing.T) {
+	for _, test := range []struct {
+		input    string
+		expected Query
+	}{
+		{"", Query{}},
+		{"  \t ", Query{}},
+		{"Billing", Query{Terms: []string{"billing"}}},
+		{"billing  migration", Query{Terms: []string{"billing", "migration"}}},
+		{`"Billing   Migration" done`, Query{Terms: []string{"billing migration", "done"}}},
+		{`"unterminated phrase`, Query{Terms: []string{"unterminated phrase"}}},
+		{`"" "  "`, Query{}},
+		{
+			"user:alice from:2020-W01 to:2020-W10 release",
+			Query{
+				Terms:    []string{"release"},
+				UserName: "alice",
+				From:     &dates.IsoWeek{Year: 2020, Week: 1},
+				To:       &dates.IsoWeek{Year: 2020, Week: 10},
+			},
+		},
+		{"user: from:2020-W99 to:never", Query{Terms: []string{"user:", "from:2020-w99", "to:never"}}},
+		{"http://example.com", Query{Terms: []string{"http://example.com"}}},
+	} {
+		if query := ParseQuery(test.input); !reflect.DeepEqual(query, test.expected) {
+			t.Errorf("Query %#v parsed as %#v instead of %#v", test.input, query, test.expected)
+		}
+	}
+}
+
+func TestEscapeLikePattern(t *testing.T) {
+	for input, expected := range map[string]string{
+		"plain":      "plain",
+		"100%":       `100\%`,
+		"snake_case": `snake\_case`,
+		`back\slash`: `back\\slash`,
+	} {
+		if escaped := EscapeLikePattern(input); escaped != expected {
+			t.Errorf("%#v escaped as %#v instead of %#v", input, escaped, expected)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package search
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/ProdriveTechnologies/snippets/pkg/dates"
+	"github.com/ProdriveTechnologies/snippets/pkg/markdown"
+	"github.com/ProdriveTechnologies/snippets/pkg/schema"
+)
+
+// Result of a search query, corresponding to a single post.
+type Result struct {
+	Post            schema.Post   `json:"post"`
+	Week            dates.IsoWeek `json:"iso_week"`
+	Score           int           `json:"score"`
+	MatchesThisWeek []string      `json:"matches_this_week"`
+	MatchesNextWeek []string      `json:"matches_next_week"`
+}
+
+// plainText converts a line of a post to lowercase text without any
+// Markdown formatting, so that terms match regardless of formatting.
+func plainText(line string, isMarkdown bool) string {
+	if isMarkdown {
+		line = markdown.PlainText(line)
+	}
+	return strings.ToLower(line)
+}
+
+// plainTextBody converts a body of a post to lowercase text without
+// any Markdown formatting, one line per line of the body.
+func plainTextBody(body string, isMarkdown bool) string {
+	lines := strings.Split(body, "\n")
+	for i, line := range lines {
+		lines[i] = plainText(line, isMarkdown)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// score computes the relevance of a body of text. Every occurrence of
+// a term counts once for every word in the term, so that matching
+// phrases weighs more heavily than matching individual words.
+func score(text string, terms []string) int {
+	total := 0
+	for _, term := range terms {
+		total += strings.Count(text, term) * len(strings.Fields(term))
+	}
+	return total
+}
+
+// Matches returns whether the text of a post contains all terms of a
+// query. Markdown formatting is ignored.
+func Matches(post schema.Post, query Query) bool {
+	thisWeek := plainTextBody(post.BodyThisWeek, post.IsMarkdown())
+	nextWeek := plainTextBody(post.BodyNextWeek, post.IsMarkdown())
+	for _, term := range query.Terms {
+		if !strings.Contains(thisWeek, term) && !strings.Contains(nextWeek, term) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchingLines(body string, isMarkdown bool, terms []string) []string {
+	var lines []string
+	for _, line := range strings.Split(body, "\n") {
+		text := plainText(line, isMarkdown)
+		for _, term := range terms {
+			if strings.Contains(text, term) {
+				lines = append(lines, line)
+				break
+			}
+		}
+	}
+	return lines
+}
+
+// Rank the posts that matched a query, so that the most relevant posts
+// come first. Posts with equal relevance are ordered from new to old.
+// Posts that do not contain any of the terms are omitted. At most limit
+// results are returned.
+func Rank(posts []schema.Post, query Query, limit int) []Result {
+	results := []Result{}
+	for _, post := range posts {
+		isMarkdown := post.IsMarkdown()
+		postScore := score(plainTextBody(post.BodyThisWeek, isMarkdown), query.Terms) + score(plainTextBody(post.BodyNextWeek, isMarkdown), query.Terms)
+		if postScore == 0 {
+			continue
+		}
+		results = append(results, Result{
+			Post:            post,
+			Week:            dates.IsoWeek{Year: post.Year, Week: post.Week},
+			Score:           postScore,
+			MatchesThisWeek: matchingLines(post.BodyThisWeek, isMarkdown, query.Terms),
+			MatchesNextWeek: matchingLines(post.BodyNextWeek, isMarkdown, query.Terms),
+		})
+	}
+	sort.SliceStable(results, func(i int, j int) bool {
+		a, b := results[i], results[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if a.Week.Year != b.Week.Year {
+			return a.Week.Year > b.Week.Year
+		}
+		return a.Week.Week > b.Week.Week
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
@@ -0,0 +1,59 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ProdriveTechnologies/snippets/pkg/schema"
+)
+
+func TestMatchesIgnoresMarkdown(t *testing.T) {
+	for _, test := range []struct {
+		query    string
+		body     string
+		format   string
+		expected bool
+	}{
+		{"snake_case", `Renamed snake\_case identifiers`, schema.PostFormatMarkdown, true},
+		{`"billing migration"`, "Finished **billing** migration", schema.PostFormatMarkdown, true},
+		{"docs", "[Wrote docs](https://example.com/)", schema.PostFormatMarkdown, true},
+		{"example", "[Wrote docs](https://example.com/)", schema.PostFormatMarkdown, false},
+		{"**billing**", "Finished **billing** migration", schema.PostFormatMarkdown, false},
+		{"**billing**", "Finished **billing** migration", schema.PostFormatPlain, true},
+		{"snake_case", `Renamed snake\_case identifiers`, schema.PostFormatPlain, false},
+		{"billing review", "Finished **billing** migration", schema.PostFormatMarkdown, false},
+	} {
+		post := schema.Post{BodyThisWeek: test.body, Format: test.format}
+		if got := Matches(post, ParseQuery(test.query)); got != test.expected {
+			t.Errorf("Query %#v matching %#v: expected %v, got %v", test.query, test.body, test.expected, got)
+		}
+	}
+}
+
+func TestRankReturnsOriginalLines(t *testing.T) {
+	post := schema.Post{
+		BodyThisWeek: "Finished **billing** migration\nUnrelated work",
+		BodyNextWeek: "Plan `billing` cleanup",
+		Format:       schema.PostFormatMarkdown,
+	}
+	results := Rank([]schema.Post{post}, ParseQuery("billing"), 10)
+	if len(results) != 1 {
+		t.Fatalf("Expected a single result, got %d", len(results))
+	}
+	if expected := []string{"Finished **billing** migration"}; !reflect.DeepEqual(results[0].MatchesThisWeek, expected) {
+		t.Errorf("Expected matches %#v, got %#v", expected, results[0].MatchesThisWeek)
+	}
+	if expected := []string{"Plan `billing` cleanup"}; !reflect.DeepEqual(results[0].MatchesNextWeek, expected) {
+		t.Errorf("Expected matches %#v, got %#v", expected, results[0].MatchesNextWeek)
+	}
+	if results[0].Score != 2 {
+		t.Errorf("Expected score 2, got %d", results[0].Score)
+	}
+}
+
+func TestQueryWords(t *testing.T) {
+	query := ParseQuery(`snake_case "billing migration" billing ** user:alice`)
+	if expected := []string{"snake", "case", "billing", "migration"}; !reflect.DeepEqual(query.Words(), expected) {
+		t.Errorf("Expected words %#v, got %#v", expected, query.Words())
+	}
+}
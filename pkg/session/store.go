@@ -0,0 +1,98 @@
+// Package session stores state of users in signed cookies, so that no
+// server side storage is needed.
+package session
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ErrInvalid is returned when a cookie is absent, has been tampered
+// with or has expired.
+var ErrInvalid = errors.New("Session cookie is absent or invalid")
+
+// Store reads and writes values from and to signed cookies.
+type Store struct {
+	Key    []byte
+	Secure bool
+}
+
+type envelope struct {
+	Expiry int64           `json:"exp"`
+	Value  json.RawMessage `json:"value"`
+}
+
+func (s *Store) sign(payload string) string {
+	mac := hmac.New(sha256.New, s.Key)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Set a cookie containing a value that remains valid for a given
+// amount of time.
+func (s *Store) Set(w http.ResponseWriter, name string, value interface{}, maxAge time.Duration) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	envelopeData, err := json.Marshal(envelope{
+		Expiry: time.Now().Add(maxAge).Unix(),
+		Value:  data,
+	})
+	if err != nil {
+		return err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(envelopeData)
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    payload + "." + s.sign(name+"="+payload),
+		Path:     "/",
+		MaxAge:   int(maxAge.Seconds()),
+		Secure:   s.Secure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+// Get the value stored in a cookie.
+func (s *Store) Get(req *http.Request, name string, value interface{}) error {
+	cookie, err := req.Cookie(name)
+	if err != nil {
+		return ErrInvalid
+	}
+	parts := strings.Split(cookie.Value, ".")
+	if len(parts) != 2 || !hmac.Equal([]byte(s.sign(name+"="+parts[0])), []byte(parts[1])) {
+		return ErrInvalid
+	}
+	envelopeData, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return ErrInvalid
+	}
+	var e envelope
+	if err := json.Unmarshal(envelopeData, &e); err != nil {
+		return ErrInvalid
+	}
+	if time.Now().After(time.Unix(e.Expiry, 0)) {
+		return ErrInvalid
+	}
+	return json.Unmarshal(e.Value, value)
+}
+
+// Clear a cookie.
+func (s *Store) Clear(w http.ResponseWriter, name string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Path:     "/",
+		MaxAge:   -1,
+		Secure:   s.Secure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
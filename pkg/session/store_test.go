@@ -0,0 +1,132 @@
+package session
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// roundTrip stores a value in a cookie and returns a request that
+// carries its value in a cookie named "session", after passing it
+// through a modification.
+func roundTrip(t *testing.T, store *Store, name string, value interface{}, maxAge time.Duration, modify func(cookie *http.Cookie)) *http.Request {
+	recorder := httptest.NewRecorder()
+	if err := store.Set(recorder, name, value, maxAge); err != nil {
+		t.Fatal(err)
+	}
+	cookies := recorder.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("Expected a single cookie, got %d", len(cookies))
+	}
+	cookie := cookies[0]
+	modify(cookie)
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(&http.Cookie{Name: "session", Value: cookie.Value})
+	return req
+}
+
+func TestStore(t *testing.T) {
+	store := &Store{Key: []byte("key")}
+	tests := []struct {
+		name    string
+		store   *Store
+		setName string
+		maxAge  time.Duration
+		modify  func(cookie *http.Cookie)
+		invalid bool
+	}{
+		{
+			name:   "Valid",
+			store:  store,
+			maxAge: time.Hour,
+			modify: func(cookie *http.Cookie) {},
+		},
+		{
+			name:    "Expired",
+			store:   store,
+			maxAge:  -time.Hour,
+			modify:  func(cookie *http.Cookie) {},
+			invalid: true,
+		},
+		{
+			name:   "TamperedPayload",
+			store:  store,
+			maxAge: time.Hour,
+			modify: func(cookie *http.Cookie) {
+				parts := strings.Split(cookie.Value, ".")
+				cookie.Value = "e30." + parts[1]
+			},
+			invalid: true,
+		},
+		{
+			name:   "TamperedSignature",
+			store:  store,
+			maxAge: time.Hour,
+			modify: func(cookie *http.Cookie) {
+				cookie.Value = strings.Split(cookie.Value, ".")[0] + ".AAAA"
+			},
+			invalid: true,
+		},
+		{
+			name:    "OtherKey",
+			store:   &Store{Key: []byte("other key")},
+			maxAge:  time.Hour,
+			modify:  func(cookie *http.Cookie) {},
+			invalid: true,
+		},
+		{
+			// Signatures are bound to the name of the cookie, so that
+			// values cannot be moved between cookies.
+			name:    "OtherName",
+			store:   store,
+			setName: "login",
+			maxAge:  time.Hour,
+			modify:  func(cookie *http.Cookie) {},
+			invalid: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setName := test.setName
+			if setName == "" {
+				setName = "session"
+			}
+			req := roundTrip(t, test.store, setName, "alice", test.maxAge, test.modify)
+			var value string
+			err := store.Get(req, "session", &value)
+			if test.invalid {
+				if err != ErrInvalid {
+					t.Fatalf("Expected ErrInvalid, got %v with value %#v", err, value)
+				}
+			} else if err != nil || value != "alice" {
+				t.Fatalf("Expected value %#v, got %#v with error %v", "alice", value, err)
+			}
+		})
+	}
+}
+
+func TestStoreMissingCookie(t *testing.T) {
+	var value string
+	if err := (&Store{Key: []byte("key")}).Get(httptest.NewRequest("GET", "/", nil), "session", &value); err != ErrInvalid {
+		t.Fatalf("Expected ErrInvalid, got %v", err)
+	}
+}
+
+func TestStoreCookieAttributes(t *testing.T) {
+	store := &Store{Key: []byte("key"), Secure: true}
+	set := httptest.NewRecorder()
+	if err := store.Set(set, "session", "value", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	cleared := httptest.NewRecorder()
+	store.Clear(cleared, "session")
+	for _, recorder := range []*httptest.ResponseRecorder{set, cleared} {
+		for _, cookie := range recorder.Result().Cookies() {
+			if !cookie.Secure || !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode {
+				t.Errorf("Cookie %#v lacks the Secure, HttpOnly or SameSite=Lax attributes", cookie.Raw)
+			}
+		}
+	}
+}
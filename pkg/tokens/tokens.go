@@ -0,0 +1,27 @@
+// Package tokens generates random secrets that users can hand to
+// clients that cannot authenticate through the authenticating proxy,
+// such as feed readers. Only hashes of tokens are stored.
+package tokens
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// Generate a new random token, returning both the token and its hash.
+func Generate() (string, string, error) {
+	var b [32]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b[:])
+	return token, Hash(token), nil
+}
+
+// Hash a token, so that it can be stored or looked up in the database.
+func Hash(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}